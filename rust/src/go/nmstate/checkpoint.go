@@ -0,0 +1,93 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrCheckpointExists is returned by ApplyNetState when a checkpoint created
+// by a previous WithNoCommit() apply of the same client was neither
+// committed nor rolled back. libnmstate only supports a single checkpoint, so
+// CommitCheckpoint or RollbackCheckpoint must be called first. A checkpoint
+// created with a timeout set by WithTimeout is forgotten once the timeout
+// elapsed, as NetworkManager then rolls it back on its own.
+var ErrCheckpointExists = errors.New("outstanding checkpoint exists")
+
+const createdCheckpointMsg = "Created checkpoint "
+
+// checkpointState is the checkpoint created by a no-commit apply and not
+// released yet, path is empty when it was not found in the apply logs.
+// expires is zero for a checkpoint NetworkManager never rolls back.
+type checkpointState struct {
+	pending bool
+	path    string
+	expires time.Time
+}
+
+// checkpointNow replaces time.Now in tests.
+var checkpointNow = time.Now
+
+// outstanding tells whether the checkpoint is pending, forgetting it once
+// NetworkManager rolled it back on timeout.
+func (c *checkpointState) outstanding() bool {
+	if c.pending && !c.expires.IsZero() && !checkpointNow().Before(c.expires) {
+		c.pending = false
+		c.path = ""
+	}
+	return c.pending
+}
+
+// checkOutstandingCheckpoint fails with ErrCheckpointExists if the client
+// knows about a checkpoint it created and did not release.
+func (n *Nmstate) checkOutstandingCheckpoint() error {
+	if !n.checkpoint.outstanding() {
+		return nil
+	}
+	path := n.checkpoint.path
+	if path == "" {
+		path = "unknown"
+	}
+	return fmt.Errorf("%w: %s, commit or rollback it before applying again", ErrCheckpointExists, path)
+}
+
+// trackCheckpoint records the checkpoint created by a no-commit apply, the
+// path is taken from the apply logs when available. libnmstate keeps the
+// checkpoint alive until the apply returns, so it expires at the latest
+// n.timeout seconds later, a timeout of 0 never expires.
+func (n *Nmstate) trackCheckpoint(logs string) {
+	n.checkpoint.pending = true
+	n.checkpoint.path = checkpointFromLog(logs)
+	n.checkpoint.expires = time.Time{}
+	if n.timeout > 0 {
+		n.checkpoint.expires = checkpointNow().Add(time.Duration(n.timeout) * time.Second)
+	}
+}
+
+// releaseCheckpoint forgets the outstanding checkpoint once checkpoint, or
+// the last active one when empty, got committed or rolled back. A checkpoint
+// whose path could not be found in the apply logs is released by any commit
+// or rollback, as it cannot be told apart from the one provided.
+func (n *Nmstate) releaseCheckpoint(checkpoint string) {
+	if checkpoint == "" || n.checkpoint.path == "" || checkpoint == n.checkpoint.path {
+		n.checkpoint.pending = false
+		n.checkpoint.path = ""
+	}
+}
+
+func checkpointFromLog(logs string) string {
+	var entries []struct {
+		Msg string `json:"msg"`
+	}
+	if err := json.Unmarshal([]byte(logs), &entries); err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Msg, createdCheckpointMsg) {
+			return strings.TrimPrefix(entry.Msg, createdCheckpointMsg)
+		}
+	}
+	return ""
+}
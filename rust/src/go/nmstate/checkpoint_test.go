@@ -0,0 +1,81 @@
+package nmstate
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyNetStateWithOutstandingCheckpoint(t *testing.T) {
+	state := `{
+"interfaces": [{
+  "name": "dummy1",
+  "state": "up",
+  "type": "dummy"
+}]}
+`
+	nms := New(WithNoCommit())
+	_, err := nms.ApplyNetState(state)
+	assert.NoError(t, err, "must succeed calling nmstate_net_state_apply c binding")
+
+	_, err = nms.ApplyNetState(state)
+	assert.True(t, errors.Is(err, ErrCheckpointExists), "must refuse applying with an outstanding checkpoint")
+
+	_, err = nms.CommitCheckpoint("")
+	assert.NoError(t, err, "must succeed commiting last active checkpoint")
+
+	_, err = nms.ApplyNetState(state)
+	assert.NoError(t, err, "must succeed applying once the checkpoint is committed")
+	_, err = nms.RollbackCheckpoint("")
+	assert.NoError(t, err, "must succeed doing rollback of last active checkpoint")
+}
+
+func TestCheckOutstandingCheckpoint(t *testing.T) {
+	nms := New(WithNoCommit())
+	assert.NoError(t, nms.checkOutstandingCheckpoint(), "new client must not have a checkpoint")
+
+	nms.trackCheckpoint(`[{"time":"1","level":"INFO","file":"nmstate::query_apply::net_state","msg":"Created checkpoint /org/freedesktop/NetworkManager/Checkpoint/7"}]`)
+	err := nms.checkOutstandingCheckpoint()
+	assert.True(t, errors.Is(err, ErrCheckpointExists), "must report the outstanding checkpoint")
+	assert.Contains(t, err.Error(), "/org/freedesktop/NetworkManager/Checkpoint/7", "error must include the checkpoint path")
+
+	nms.releaseCheckpoint("/org/freedesktop/NetworkManager/Checkpoint/7")
+	assert.NoError(t, nms.checkOutstandingCheckpoint(), "released checkpoint must not be reported")
+}
+
+func TestReleaseCheckpointWithoutPath(t *testing.T) {
+	nms := New(WithNoCommit())
+	nms.trackCheckpoint(`[{"time":"1","level":"INFO","file":"nmstate::query_apply::net_state","msg":"Applying"}]`)
+	err := nms.checkOutstandingCheckpoint()
+	assert.True(t, errors.Is(err, ErrCheckpointExists), "must report the outstanding checkpoint")
+	assert.Contains(t, err.Error(), "unknown", "error must tell the checkpoint path is unknown")
+
+	nms.releaseCheckpoint("/org/freedesktop/NetworkManager/Checkpoint/7")
+	assert.NoError(t, nms.checkOutstandingCheckpoint(), "checkpoint without known path must be released by an explicit path")
+
+	nms.trackCheckpoint(`[{"time":"1","level":"INFO","file":"nmstate::query_apply::net_state","msg":"Created checkpoint /org/freedesktop/NetworkManager/Checkpoint/8"}]`)
+	nms.releaseCheckpoint("/org/freedesktop/NetworkManager/Checkpoint/7")
+	assert.Error(t, nms.checkOutstandingCheckpoint(), "releasing another known checkpoint must keep it outstanding")
+}
+
+func TestExpiredCheckpoint(t *testing.T) {
+	now := time.Now()
+	checkpointNow = func() time.Time { return now }
+	defer func() { checkpointNow = time.Now }()
+
+	nms := New(WithNoCommit(), WithTimeout(30*time.Second))
+	nms.trackCheckpoint(`[{"time":"1","level":"INFO","file":"nmstate::query_apply::net_state","msg":"Created checkpoint /org/freedesktop/NetworkManager/Checkpoint/7"}]`)
+	now = now.Add(29 * time.Second)
+	assert.True(t, errors.Is(nms.checkOutstandingCheckpoint(), ErrCheckpointExists), "checkpoint must be outstanding before its timeout")
+
+	now = now.Add(time.Second)
+	assert.NoError(t, nms.checkOutstandingCheckpoint(), "checkpoint rolled back by NetworkManager on timeout must be forgotten")
+	assert.Zero(t, nms.DiagnoseLeaks().OutstandingCheckpoints, "expired checkpoint must not be reported as a leak")
+
+	nms = New(WithNoCommit())
+	nms.trackCheckpoint("")
+	now = now.Add(24 * time.Hour)
+	assert.Error(t, nms.checkOutstandingCheckpoint(), "checkpoint without timeout must never expire")
+}
@@ -0,0 +1,66 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// configFlags maps the flag names accepted by NewFromConfig to their option.
+var configFlags = map[string]func() func(*Nmstate){
+	"kernel-only":         WithKernelOnly,
+	"no-verify":           WithNoVerify,
+	"include-status-data": WithIncludeStatusData,
+	"include-secrets":     WithIncludeSecrets,
+	"no-commit":           WithNoCommit,
+	"memory-only":         WithMemoryOnly,
+	"running-config-only": WithRunningConfigOnly,
+}
+
+type clientConfig struct {
+	// Timeout is in seconds, like the timeout given to libnmstate.
+	Timeout uint     `json:"timeout"`
+	Flags   []string `json:"flags"`
+}
+
+// NewFromConfig returns a client configured by a json document like
+// {"timeout": 30, "flags": ["no-commit", "kernel-only"]}, with timeout in
+// seconds and flags named after their With option. Only json is accepted,
+// unknown keys, flag names and data after the document are rejected. The
+// log level is not configurable this way, libnmstate logs are only routed
+// by WithLogsWritter. The options provided are applied after the config.
+func NewFromConfig(configJSON string, options ...func(*Nmstate)) (*Nmstate, error) {
+	decoder := json.NewDecoder(strings.NewReader(configJSON))
+	decoder.DisallowUnknownFields()
+	config := clientConfig{}
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed parsing config: %v", err)
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return nil, fmt.Errorf("failed parsing config: unexpected data after the config document")
+	}
+	configOptions := []func(*Nmstate){}
+	if config.Timeout > 0 {
+		configOptions = append(configOptions, WithTimeout(time.Duration(config.Timeout)*time.Second))
+	}
+	for _, name := range config.Flags {
+		flag, ok := configFlags[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown flag %q in config, supported flags: %s", name, strings.Join(configFlagNames(), ", "))
+		}
+		configOptions = append(configOptions, flag())
+	}
+	return New(append(configOptions, options...)...), nil
+}
+
+func configFlagNames() []string {
+	names := make([]string, 0, len(configFlags))
+	for name := range configFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
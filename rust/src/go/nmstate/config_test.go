@@ -0,0 +1,33 @@
+package nmstate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	nms, err := NewFromConfig(`{"timeout": 30, "flags": ["no-commit", "kernel-only"]}`)
+	assert.NoError(t, err, "must succeed creating client from config")
+	assert.Equal(t, New(WithTimeout(30*time.Second), WithNoCommit(), WithKernelOnly()), nms)
+
+	nms, err = NewFromConfig(`{}`, WithRequestID("req-1"))
+	assert.NoError(t, err, "must succeed creating client from empty config")
+	assert.Equal(t, New(WithRequestID("req-1")), nms)
+}
+
+func TestNewFromConfigInvalid(t *testing.T) {
+	_, err := NewFromConfig(`{"flags": ["no-commit", "dry-run"]}`)
+	assert.EqualError(t, err, `unknown flag "dry-run" in config, supported flags: `+
+		"include-secrets, include-status-data, kernel-only, memory-only, no-commit, no-verify, running-config-only")
+
+	_, err = NewFromConfig(`{"timeout": 30, "log-level": "debug"}`)
+	assert.EqualError(t, err, `failed parsing config: json: unknown field "log-level"`)
+
+	_, err = NewFromConfig(`{"timeout": 5} junk`)
+	assert.EqualError(t, err, "failed parsing config: unexpected data after the config document")
+
+	_, err = NewFromConfig(`{"timeout": 5} {"flags": ["no-commit"]}`)
+	assert.EqualError(t, err, "failed parsing config: unexpected data after the config document")
+}
@@ -0,0 +1,171 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DiffAgainstBaseline reads a baseline network state in json format from
+// baseline and returns its differences with the current network state, see
+// DiffStates. An empty diff means the current state matches the baseline.
+func (n *Nmstate) DiffAgainstBaseline(baseline io.Reader) (string, error) {
+	content, err := io.ReadAll(baseline)
+	if err != nil {
+		return "", fmt.Errorf("failed reading baseline: %v", err)
+	}
+	current, err := n.RetrieveNetState()
+	if err != nil {
+		return "", err
+	}
+	return DiffStates(string(content), current)
+}
+
+// DiffStates returns the differences between two network states in json
+// format, one line per property sorted by path: "- path: value" for a
+// property only in a, "+ path: value" for a property only in b and
+// "~ path: value -> value" for a changed one. Interfaces are matched by name
+// and type, the read-only properties removed by StripReadOnly are ignored as
+// they change without any configuration change.
+func DiffStates(a, b string) (string, error) {
+	stateA, err := decodeState(a)
+	if err != nil {
+		return "", err
+	}
+	stateB, err := decodeState(b)
+	if err != nil {
+		return "", err
+	}
+	lines := []string{}
+	diffInterfaces(stateInterfaces(stateA), stateInterfaces(stateB), &lines)
+	delete(stateA, "interfaces")
+	delete(stateB, "interfaces")
+	diffValues("", stateA, stateB, &lines)
+	// Lines start with the sign and a space, sort on the path after them.
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][2:] < lines[j][2:]
+	})
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// InterfaceDiff compares the interface names of two network states in json
+// format and returns, sorted, the names only in a, only in b and in both.
+// Interfaces sharing a name, like an ovs-bridge and its ovs-interface, count
+// as one name. See DiffStates for the property level differences.
+func InterfaceDiff(a, b string) (onlyInA, onlyInB, inBoth []string, err error) {
+	namesA, err := interfaceNames(a)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	namesB, err := interfaceNames(b)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	onlyInA, onlyInB, inBoth = []string{}, []string{}, []string{}
+	for name := range namesA {
+		if namesB[name] {
+			inBoth = append(inBoth, name)
+		} else {
+			onlyInA = append(onlyInA, name)
+		}
+	}
+	for name := range namesB {
+		if !namesA[name] {
+			onlyInB = append(onlyInB, name)
+		}
+	}
+	sort.Strings(onlyInA)
+	sort.Strings(onlyInB)
+	sort.Strings(inBoth)
+	return onlyInA, onlyInB, inBoth, nil
+}
+
+func interfaceNames(state string) (map[string]bool, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, iface := range stateInterfaces(netState) {
+		names[stringField(iface, "name")] = true
+	}
+	return names, nil
+}
+
+func diffInterfaces(a, b []map[string]interface{}, lines *[]string) {
+	index := func(ifaces []map[string]interface{}) map[string]interface{} {
+		indexed := map[string]interface{}{}
+		for _, iface := range ifaces {
+			removeFields(iface, readOnlyInterfaceFields)
+			key := stringField(iface, "name")
+			if ifType := stringField(iface, "type"); ifType != "" {
+				key += "/" + ifType
+			}
+			indexed[key] = iface
+		}
+		return indexed
+	}
+	indexedA, indexedB := index(a), index(b)
+	for key := range indexedA {
+		if _, ok := indexedB[key]; !ok {
+			*lines = append(*lines, diffLine("-", "interfaces["+key+"]", indexedA[key]))
+		}
+	}
+	for key, iface := range indexedB {
+		other, ok := indexedA[key]
+		if !ok {
+			*lines = append(*lines, diffLine("+", "interfaces["+key+"]", iface))
+			continue
+		}
+		diffValues("interfaces["+key+"]", other.(map[string]interface{}), iface.(map[string]interface{}), lines)
+	}
+}
+
+func diffValues(path string, a, b map[string]interface{}, lines *[]string) {
+	for key, value := range a {
+		if _, ok := b[key]; !ok {
+			*lines = append(*lines, diffLine("-", joinPath(path, key), value))
+		}
+	}
+	for key, value := range b {
+		other, ok := a[key]
+		switch {
+		case !ok:
+			*lines = append(*lines, diffLine("+", joinPath(path, key), value))
+		case reflect.DeepEqual(other, value):
+		default:
+			objectA, isObjectA := other.(map[string]interface{})
+			objectB, isObjectB := value.(map[string]interface{})
+			if isObjectA && isObjectB {
+				diffValues(joinPath(path, key), objectA, objectB, lines)
+			} else {
+				*lines = append(*lines, fmt.Sprintf("~ %s: %s -> %s", joinPath(path, key), encodeValue(other), encodeValue(value)))
+			}
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func diffLine(sign, path string, value interface{}) string {
+	return fmt.Sprintf("%s %s: %s", sign, path, encodeValue(value))
+}
+
+func encodeValue(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(encoded)
+}
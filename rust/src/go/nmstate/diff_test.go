@@ -0,0 +1,75 @@
+package nmstate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const baselineState = `{
+"interfaces": [
+  {"name": "eth1", "type": "ethernet", "state": "up", "mtu": 1500, "min-mtu": 68},
+  {"name": "eth2", "type": "ethernet", "state": "up"}
+],
+"dns-resolver": {"running": {"server": ["192.0.2.53"]}}
+}`
+
+func TestDiffStates(t *testing.T) {
+	diff, err := DiffStates(baselineState, `{
+"interfaces": [
+  {"name": "eth1", "type": "ethernet", "state": "up", "mtu": 9000, "min-mtu": 60},
+  {"name": "dummy1", "type": "dummy", "state": "up"}
+],
+"dns-resolver": {"running": {"server": ["192.0.2.53"]}}
+}`)
+	assert.NoError(t, err, "must succeed diffing states")
+	assert.Equal(t, `+ interfaces[dummy1/dummy]: {"name":"dummy1","state":"up","type":"dummy"}
+~ interfaces[eth1/ethernet].mtu: 1500 -> 9000
+- interfaces[eth2/ethernet]: {"name":"eth2","state":"up","type":"ethernet"}
+`, diff)
+}
+
+func TestDiffStatesIdentical(t *testing.T) {
+	diff, err := DiffStates(baselineState, baselineState)
+	assert.NoError(t, err, "must succeed diffing states")
+	assert.Empty(t, diff, "identical states should have no diff")
+}
+
+func TestDiffAgainstBaseline(t *testing.T) {
+	nms := New()
+	current, err := nms.RetrieveNetState()
+	assert.NoError(t, err, "must succeed calling retrieve_net_state c binding")
+
+	diff, err := nms.DiffAgainstBaseline(strings.NewReader(current))
+	assert.NoError(t, err, "must succeed diffing against the baseline")
+	assert.NotContains(t, diff, "interfaces[lo/loopback]", "unchanged interface should not be reported")
+}
+
+func TestInterfaceDiffDisjoint(t *testing.T) {
+	onlyInA, onlyInB, inBoth, err := InterfaceDiff(
+		`{"interfaces": [{"name": "eth2"}, {"name": "eth1"}]}`,
+		`{"interfaces": [{"name": "dummy1"}]}`)
+	assert.NoError(t, err, "must succeed diffing interfaces")
+	assert.Equal(t, []string{"eth1", "eth2"}, onlyInA)
+	assert.Equal(t, []string{"dummy1"}, onlyInB)
+	assert.Empty(t, inBoth)
+}
+
+func TestInterfaceDiffOverlapping(t *testing.T) {
+	onlyInA, onlyInB, inBoth, err := InterfaceDiff(
+		`{"interfaces": [{"name": "eth2"}, {"name": "br0", "type": "ovs-bridge"}, {"name": "br0", "type": "ovs-interface"}]}`,
+		`{"interfaces": [{"name": "br0", "type": "ovs-bridge"}, {"name": "eth3"}]}`)
+	assert.NoError(t, err, "must succeed diffing interfaces")
+	assert.Equal(t, []string{"eth2"}, onlyInA)
+	assert.Equal(t, []string{"eth3"}, onlyInB)
+	assert.Equal(t, []string{"br0"}, inBoth, "interfaces sharing a name must be reported once")
+}
+
+func TestInterfaceDiffIdentical(t *testing.T) {
+	onlyInA, onlyInB, inBoth, err := InterfaceDiff(baselineState, baselineState)
+	assert.NoError(t, err, "must succeed diffing interfaces")
+	assert.Empty(t, onlyInA)
+	assert.Empty(t, onlyInB)
+	assert.Equal(t, []string{"eth1", "eth2"}, inBoth)
+}
@@ -0,0 +1,106 @@
+package nmstate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// featureProbes are minimal network states exercising each feature known to
+// SupportsFeature, {name} and {peer} are replaced by interface names not in
+// the current state.
+var featureProbes = map[string]string{
+	"dummy":        `{"interfaces": [{"name": "{name}", "type": "dummy", "state": "up"}]}`,
+	"veth":         `{"interfaces": [{"name": "{name}", "type": "veth", "state": "up", "veth": {"peer": "{peer}"}}]}`,
+	"linux-bridge": `{"interfaces": [{"name": "{name}", "type": "linux-bridge", "state": "up", "bridge": {"port": []}}]}`,
+	"bond":         `{"interfaces": [{"name": "{name}", "type": "bond", "state": "up", "link-aggregation": {"mode": "active-backup", "port": []}}]}`,
+	"vrf":          `{"interfaces": [{"name": "{name}", "type": "vrf", "state": "up", "vrf": {"port": [], "route-table-id": 4242}}]}`,
+}
+
+// unsupportedKinds are the libnmstate error kinds reported by SupportsFeature
+// as an unsupported feature.
+var unsupportedKinds = map[string]bool{
+	"NotSupportedError":   true,
+	"NotImplementedError": true,
+}
+
+// SupportsFeature reports whether the running kernel and NetworkManager can
+// create the interface type named by feature, one of SupportedFeatureProbes().
+// libnmstate does not report capabilities, so the feature is probed by
+// applying a minimal state using it, on interfaces named nmprobe<N> not in
+// the current state, with WithNoCommit() semantics and rolling it back right
+// after. Only a NotSupportedError or NotImplementedError failure of that apply
+// is reported as unsupported, any other failure is returned as error. It
+// fails with ErrCheckpointExists while a checkpoint is outstanding.
+func (n *Nmstate) SupportsFeature(feature string) (bool, error) {
+	if _, ok := featureProbes[feature]; !ok {
+		return false, fmt.Errorf("unknown feature %q, known features: %v", feature, SupportedFeatureProbes())
+	}
+	if err := n.checkOutstandingCheckpoint(); err != nil {
+		return false, err
+	}
+	current, err := n.RetrieveNetState()
+	if err != nil {
+		return false, err
+	}
+	supported, err := probeFeature(feature, current, func(probe string) error {
+		_, err := n.applyNetState(probe, n.flags|noCommit)
+		return err
+	})
+	if !supported || err != nil {
+		return supported, err
+	}
+	if _, err := n.RollbackCheckpoint(""); err != nil {
+		return true, fmt.Errorf("failed rolling back %s feature probe: %v", feature, err)
+	}
+	return true, nil
+}
+
+// probeFeature applies the probe of feature, using interface names not in the
+// current state, and maps an unsupported failure to false.
+func probeFeature(feature, current string, apply func(probe string) error) (bool, error) {
+	name, peer, err := probeNames(current)
+	if err != nil {
+		return false, err
+	}
+	probe := strings.NewReplacer("{name}", name, "{peer}", peer).Replace(featureProbes[feature])
+	if err := apply(probe); err != nil {
+		var kindErr *kindError
+		if errors.As(err, &kindErr) && unsupportedKinds[kindErr.kind] {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed probing %s feature: %w", feature, err)
+	}
+	return true, nil
+}
+
+// probeNames returns the first two consecutive nmprobe<N> names not used by
+// an interface of the current state.
+func probeNames(current string) (string, string, error) {
+	netState, err := decodeState(current)
+	if err != nil {
+		return "", "", err
+	}
+	existing := map[string]bool{}
+	for _, iface := range stateInterfaces(netState) {
+		existing[stringField(iface, "name")] = true
+	}
+	for i := 0; ; i++ {
+		name, peer := "nmprobe"+strconv.Itoa(i), "nmprobe"+strconv.Itoa(i+1)
+		if !existing[name] && !existing[peer] {
+			return name, peer, nil
+		}
+	}
+}
+
+// SupportedFeatureProbes returns the features SupportsFeature can probe.
+func SupportedFeatureProbes() []string {
+	features := make([]string, 0, len(featureProbes))
+	for feature := range featureProbes {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	return features
+}
@@ -0,0 +1,59 @@
+package nmstate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupportsFeature(t *testing.T) {
+	nms := New()
+	current, err := nms.RetrieveNetState()
+	assert.NoError(t, err, "must succeed calling retrieve_net_state c binding")
+	probe, _, err := probeNames(current)
+	assert.NoError(t, err)
+
+	supported, err := nms.SupportsFeature("dummy")
+	assert.NoError(t, err, "must succeed probing dummy interfaces")
+	assert.True(t, supported, "dummy interfaces should be supported")
+
+	dummies, err := nms.RetrieveByType("dummy")
+	assert.NoError(t, err, "must succeed retrieving dummy interfaces")
+	assert.NotContains(t, dummies, `"`+probe+`"`, "probe must be rolled back")
+}
+
+func TestSupportsFeatureUnknown(t *testing.T) {
+	_, err := New().SupportsFeature("time-travel")
+	assert.Error(t, err, "must fail on unknown feature")
+	assert.Contains(t, SupportedFeatureProbes(), "vrf")
+}
+
+func TestProbeFeatureUnsupported(t *testing.T) {
+	current := `{"interfaces": [{"name": "nmprobe0", "type": "dummy"}, {"name": "nmprobe2", "type": "dummy"}]}`
+	probes := []string{}
+	supported, err := probeFeature("vrf", current, func(probe string) error {
+		probes = append(probes, probe)
+		return &kindError{kind: "NotSupportedError", err: errors.New("vrf is not supported")}
+	})
+	assert.NoError(t, err, "unsupported feature must not be an error")
+	assert.False(t, supported, "vrf must be reported as unsupported")
+	assert.Equal(t, []string{`{"interfaces": [{"name": "nmprobe3", "type": "vrf", "state": "up", "vrf": {"port": [], "route-table-id": 4242}}]}`}, probes,
+		"probe must use names not in the current state")
+}
+
+func TestProbeFeatureFailure(t *testing.T) {
+	supported, err := probeFeature("dummy", `{"interfaces": []}`, func(probe string) error {
+		return &kindError{kind: "PermissionError", err: errors.New("permission denied")}
+	})
+	assert.EqualError(t, err, "failed probing dummy feature: permission denied", "other failures must be returned")
+	assert.False(t, supported)
+
+	supported, err = probeFeature("veth", `{"interfaces": []}`, func(probe string) error {
+		assert.Contains(t, probe, `"name": "nmprobe0"`)
+		assert.Contains(t, probe, `"peer": "nmprobe1"`)
+		return nil
+	})
+	assert.NoError(t, err, "must succeed probing veth")
+	assert.True(t, supported)
+}
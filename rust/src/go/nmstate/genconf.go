@@ -0,0 +1,162 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NetworkManagerBackend is the GenerateConfiguration backend holding the
+// NetworkManager keyfiles.
+const NetworkManagerBackend = "NetworkManager"
+
+// ParseGeneratedConfigurations parses the output of GenerateConfiguration.
+// It returns the configuration files content indexed by backend name and
+// then by file name.
+func ParseGeneratedConfigurations(configs string) (map[string]map[string]string, error) {
+	var raw map[string][][2]string
+	if err := json.Unmarshal([]byte(configs), &raw); err != nil {
+		return nil, fmt.Errorf("failed parsing generated configurations: %v", err)
+	}
+	parsed := map[string]map[string]string{}
+	for backend, files := range raw {
+		parsed[backend] = map[string]string{}
+		for _, file := range files {
+			parsed[backend][file[0]] = file[1]
+		}
+	}
+	return parsed, nil
+}
+
+// WriteGeneratedConfigs generates the NetworkManager keyfiles for the state
+// provided and writes each of them into dir with 0600 permissions. Files are
+// written to a temporary file and renamed so readers never see a partial
+// keyfile. Existing files are overwritten unless WithSkipExistingConfigs()
+// is set. This function returns the paths written or an error.
+func (n *Nmstate) WriteGeneratedConfigs(state, dir string) ([]string, error) {
+	configs, err := n.GenerateConfiguration(state)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := ParseGeneratedConfigurations(configs)
+	if err != nil {
+		return nil, err
+	}
+	return n.writeConfigs(parsed[NetworkManagerBackend], dir)
+}
+
+func (n *Nmstate) writeConfigs(files map[string]string, dir string) ([]string, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if name != filepath.Base(name) || name == "." || name == ".." {
+			return nil, fmt.Errorf("invalid generated configuration file name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	written := []string{}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if n.skipExistingConfigs {
+			if _, err := os.Stat(path); err == nil {
+				continue
+			}
+		}
+		if err := writeFileAtomic(path, files[name]); err != nil {
+			return written, fmt.Errorf("failed writing generated configuration %s: %v", path, err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// LiveConfigDrift generates the NetworkManager keyfiles for the state
+// provided and compares them with the files in systemConnectionsDir, like
+// /etc/NetworkManager/system-connections. It returns a summary for every
+// file which drifted, indexed by file name: "missing" for a generated file
+// not on disk, "not generated" for a file on disk nmstate does not generate,
+// and otherwise the changed keys from the generated to the file on disk, see
+// diffKeyfiles. Hidden files are ignored. An empty map means no drift.
+func (n *Nmstate) LiveConfigDrift(state, systemConnectionsDir string) (map[string]string, error) {
+	configs, err := n.GenerateConfiguration(state)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := ParseGeneratedConfigurations(configs)
+	if err != nil {
+		return nil, err
+	}
+	return configDrift(parsed[NetworkManagerBackend], systemConnectionsDir)
+}
+
+func configDrift(generated map[string]string, dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading configurations directory: %v", err)
+	}
+	live := map[string]string{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed reading configuration %s: %v", entry.Name(), err)
+		}
+		live[entry.Name()] = string(content)
+	}
+
+	drift := map[string]string{}
+	for name, content := range generated {
+		liveContent, ok := live[name]
+		if !ok {
+			drift[name] = "missing"
+			continue
+		}
+		if liveContent == content {
+			continue
+		}
+		lines, err := diffKeyfiles(content, liveContent)
+		if err != nil {
+			drift[name] = fmt.Sprintf("differs and is not a valid keyfile: %v", err)
+			continue
+		}
+		if len(lines) > 0 {
+			drift[name] = strings.Join(lines, "\n")
+		}
+	}
+	for name := range live {
+		if _, ok := generated[name]; !ok {
+			drift[name] = "not generated"
+		}
+	}
+	return drift, nil
+}
+
+func writeFileAtomic(path, content string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,107 @@
+package nmstate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGeneratedConfigurations(t *testing.T) {
+	configs, err := ParseGeneratedConfigurations(`{"NetworkManager":[["dummy1.nmconnection","[connection]\nid=dummy1\n"]]}`)
+	assert.NoError(t, err, "must succeed parsing generated configurations")
+	assert.Equal(t, map[string]map[string]string{
+		NetworkManagerBackend: {"dummy1.nmconnection": "[connection]\nid=dummy1\n"},
+	}, configs)
+}
+
+func TestWriteGeneratedConfigs(t *testing.T) {
+	dir := t.TempDir()
+	nms := New()
+	paths, err := nms.WriteGeneratedConfigs(`{
+"interfaces": [{
+  "name": "dummy1",
+  "state": "up",
+  "type": "dummy"
+}]}
+`, dir)
+	assert.NoError(t, err, "must succeed writing generated configurations")
+	assert.Equal(t, []string{filepath.Join(dir, "dummy1.nmconnection")}, paths)
+}
+
+func TestWriteConfigs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"dummy1.nmconnection": "[connection]\nid=dummy1\n",
+		"dummy2.nmconnection": "[connection]\nid=dummy2\n",
+	}
+	existing := filepath.Join(dir, "dummy2.nmconnection")
+	assert.NoError(t, os.WriteFile(existing, []byte("[connection]\nid=custom\n"), 0600))
+
+	paths, err := New(WithSkipExistingConfigs()).writeConfigs(files, dir)
+	assert.NoError(t, err, "must succeed writing configurations")
+	assert.Equal(t, []string{filepath.Join(dir, "dummy1.nmconnection")}, paths, "existing file must be skipped")
+	content, err := os.ReadFile(existing)
+	assert.NoError(t, err)
+	assert.Equal(t, "[connection]\nid=custom\n", string(content), "skipped file must be untouched")
+
+	paths, err = New().writeConfigs(files, dir)
+	assert.NoError(t, err, "must succeed writing configurations")
+	assert.Len(t, paths, 2, "existing file must be overwritten")
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "configuration must only be readable by owner")
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, files[filepath.Base(path)], string(content))
+	}
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2, "no temporary file must be left behind")
+
+	_, err = New().writeConfigs(map[string]string{"../escape.nmconnection": ""}, dir)
+	assert.Error(t, err, "must refuse file names outside of the target directory")
+}
+
+func TestConfigDrift(t *testing.T) {
+	dir := t.TempDir()
+	generated := map[string]string{
+		"dummy1.nmconnection": "[connection]\nid=dummy1\ntype=dummy\n",
+		"dummy2.nmconnection": "[connection]\nid=dummy2\ntype=dummy\n\n[wifi-security]\npsk=generated\n",
+		"dummy3.nmconnection": "[connection]\nid=dummy3\n",
+	}
+	live := map[string]string{
+		"dummy1.nmconnection":       "# edited by hand\n[connection]\ntype=dummy\nid=dummy1\n",
+		"dummy2.nmconnection":       "[connection]\nid=dummy2\nautoconnect=false\n\n[wifi-security]\npsk=changed\n",
+		"eth1.nmconnection":         "[connection]\nid=eth1\n",
+		".eth1.nmconnection.tmp123": "",
+	}
+	for name, content := range live {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+
+	drift, err := configDrift(generated, dir)
+	assert.NoError(t, err, "must succeed computing drift")
+	assert.Equal(t, map[string]string{
+		"dummy2.nmconnection": "+ connection.autoconnect: false\n" +
+			"- connection.type: dummy\n" +
+			"~ wifi-security.psk: <_password_hid_by_nmstate> -> <_password_hid_by_nmstate>",
+		"dummy3.nmconnection": "missing",
+		"eth1.nmconnection":   "not generated",
+	}, drift, "reordered keys and comments must not be reported as drift")
+}
+
+func TestLiveConfigDrift(t *testing.T) {
+	dir := t.TempDir()
+	state := `{"interfaces": [{"name": "dummy1", "state": "up", "type": "dummy"}]}`
+	nms := New()
+	_, err := nms.WriteGeneratedConfigs(state, dir)
+	assert.NoError(t, err, "must succeed writing generated configurations")
+
+	drift, err := nms.LiveConfigDrift(state, dir)
+	assert.NoError(t, err, "must succeed computing drift")
+	assert.Empty(t, drift, "freshly written configurations must not drift")
+}
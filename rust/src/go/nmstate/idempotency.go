@@ -0,0 +1,118 @@
+package nmstate
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultIdempotencyTTL = 5 * time.Minute
+
+type idempotentResult struct {
+	// fingerprint is the hash of the client options and the state applied.
+	fingerprint [sha256.Size]byte
+	applied     string
+	expires     time.Time
+}
+
+// idempotencyCache holds the results of the applies made with
+// WithIdempotencyKey, shared by all the clients of the process. inFlight
+// holds the keys being applied, their channel is closed once done.
+var idempotencyCache = struct {
+	sync.Mutex
+	results  map[string]idempotentResult
+	inFlight map[string]chan struct{}
+}{results: map[string]idempotentResult{}, inFlight: map[string]chan struct{}{}}
+
+// idempotencyNow replaces time.Now in tests.
+var idempotencyNow = time.Now
+
+// applyIdempotent returns the result remembered for key, or calls apply and
+// remembers its result if it succeeds. A result is only returned for the same
+// state applied with the same client options, so for instance a WithNoCommit()
+// client never gets the result of an apply which was committed. A call with a
+// key being applied waits for that apply, and returns its result or, if it
+// failed, applies itself.
+func (n *Nmstate) applyIdempotent(key, state string, apply func(state string) (string, error)) (string, error) {
+	fingerprint := n.idempotencyFingerprint(state)
+	idempotencyCache.Lock()
+	for {
+		if result, ok := cachedIdempotentResult(key); ok {
+			idempotencyCache.Unlock()
+			if result.fingerprint != fingerprint {
+				return "", idempotencyConflict(key)
+			}
+			return result.applied, nil
+		}
+		done, ok := idempotencyCache.inFlight[key]
+		if !ok {
+			break
+		}
+		idempotencyCache.Unlock()
+		<-done
+		idempotencyCache.Lock()
+	}
+	done := make(chan struct{})
+	idempotencyCache.inFlight[key] = done
+	idempotencyCache.Unlock()
+
+	applied, err := apply(state)
+
+	idempotencyCache.Lock()
+	defer idempotencyCache.Unlock()
+	delete(idempotencyCache.inFlight, key)
+	close(done)
+	if err != nil {
+		return "", err
+	}
+	ttl := n.idempotencyTTL
+	if ttl == 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	idempotencyCache.results[key] = idempotentResult{
+		fingerprint: fingerprint,
+		applied:     applied,
+		expires:     idempotencyNow().Add(ttl),
+	}
+	return applied, nil
+}
+
+// idempotencyFingerprint identifies the apply of state by this client: the
+// state and every option changing what gets applied or how.
+func (n *Nmstate) idempotencyFingerprint(state string) [sha256.Size]byte {
+	managed := make([]string, 0, len(n.managedInterfaces))
+	for name := range n.managedInterfaces {
+		managed = append(managed, name)
+	}
+	sort.Strings(managed)
+	options, _ := json.Marshal(struct {
+		Flags               byte
+		Timeout             uint
+		StripReadOnly       bool
+		IgnoreMissingAbsent bool
+		ManagedInterfaces   []string
+		RollbackTarget      string
+		RollbackTimeout     time.Duration
+	}{n.flags, n.timeout, n.stripReadOnly, n.ignoreMissingAbsent, managed, n.rollbackTarget, n.rollbackTimeout})
+	return sha256.Sum256(append(append(options, 0), state...))
+}
+
+// cachedIdempotentResult returns the result remembered for key, dropping the
+// expired ones. The cache must be locked.
+func cachedIdempotentResult(key string) (idempotentResult, bool) {
+	now := idempotencyNow()
+	for cached, result := range idempotencyCache.results {
+		if !now.Before(result.expires) {
+			delete(idempotencyCache.results, cached)
+		}
+	}
+	result, ok := idempotencyCache.results[key]
+	return result, ok
+}
+
+func idempotencyConflict(key string) error {
+	return fmt.Errorf("idempotency key %q was already used to apply a different state or with different options", key)
+}
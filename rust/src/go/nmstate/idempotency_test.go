@@ -0,0 +1,150 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyIdempotent(t *testing.T) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	idempotencyNow = func() time.Time { return now }
+	defer func() { idempotencyNow = time.Now }()
+
+	state := `{"interfaces": [{"name": "dummy1", "type": "dummy", "state": "up"}]}`
+	applies := 0
+	apply := func(state string) (string, error) {
+		applies++
+		return state, nil
+	}
+	nms := New(WithIdempotencyKey("TestApplyIdempotent"), WithIdempotencyTTL(time.Minute))
+	applied, err := nms.applyIdempotent("TestApplyIdempotent", state, apply)
+	assert.NoError(t, err, "must succeed applying")
+	assert.Equal(t, state, applied)
+
+	now = now.Add(59 * time.Second)
+	applied, err = New(WithIdempotencyKey("TestApplyIdempotent")).applyIdempotent("TestApplyIdempotent", state, apply)
+	assert.NoError(t, err, "must succeed applying a duplicate")
+	assert.Equal(t, state, applied, "duplicate must return the remembered result")
+	assert.Equal(t, 1, applies, "duplicate within the TTL must not apply again, even from another client")
+
+	_, err = nms.applyIdempotent("TestApplyIdempotent", `{"interfaces": []}`, apply)
+	assert.EqualError(t, err, `idempotency key "TestApplyIdempotent" was already used to apply a different state or with different options`)
+
+	now = now.Add(time.Second)
+	_, err = nms.applyIdempotent("TestApplyIdempotent", state, apply)
+	assert.NoError(t, err, "must succeed applying after the TTL")
+	assert.Equal(t, 2, applies, "duplicate after the TTL must apply again")
+}
+
+func TestApplyIdempotentFailure(t *testing.T) {
+	applies := 0
+	nms := New(WithIdempotencyKey("TestApplyIdempotentFailure"))
+	_, err := nms.applyIdempotent("TestApplyIdempotentFailure", "{}", func(state string) (string, error) {
+		applies++
+		return "", errors.New("apply failed")
+	})
+	assert.EqualError(t, err, "apply failed")
+
+	_, err = nms.applyIdempotent("TestApplyIdempotentFailure", "{}", func(state string) (string, error) {
+		applies++
+		return state, nil
+	})
+	assert.NoError(t, err, "must succeed retrying a failed apply")
+	assert.Equal(t, 2, applies, "failed applies must not be remembered")
+}
+
+func TestApplyIdempotentFlags(t *testing.T) {
+	apply := func(state string) (string, error) { return state, nil }
+	_, err := New().applyIdempotent("TestApplyIdempotentFlags", "{}", apply)
+	assert.NoError(t, err, "must succeed applying")
+
+	_, err = New(WithNoCommit()).applyIdempotent("TestApplyIdempotentFlags", "{}", apply)
+	assert.EqualError(t, err, `idempotency key "TestApplyIdempotentFlags" was already used to apply a different state or with different options`,
+		"a result applied with other flags must not be returned")
+}
+
+func TestApplyIdempotentOptions(t *testing.T) {
+	apply := func(state string) (string, error) { return state, nil }
+	_, err := New(WithTimeout(30*time.Second)).applyIdempotent("TestApplyIdempotentOptions", "{}", apply)
+	assert.NoError(t, err, "must succeed applying")
+
+	for _, option := range []func(*Nmstate){
+		WithTimeout(60 * time.Second),
+		WithStripReadOnlyOnApply(),
+		WithIgnoreMissingAbsent(),
+		WithManagedInterfaces("dummy1"),
+		WithRollbackIfUnreachable("192.0.2.1:22", 10*time.Second),
+	} {
+		_, err = New(WithTimeout(30*time.Second), option).applyIdempotent("TestApplyIdempotentOptions", "{}", apply)
+		assert.EqualError(t, err, `idempotency key "TestApplyIdempotentOptions" was already used to apply a different state or with different options`,
+			"a result applied with other options must not be returned")
+	}
+}
+
+func TestApplyIdempotentConcurrent(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	var applies int32
+	apply := func(state string) (string, error) {
+		if atomic.AddInt32(&applies, 1) == 1 {
+			close(started)
+			<-unblock
+		}
+		return state, nil
+	}
+	defer func() {
+		idempotencyCache.Lock()
+		delete(idempotencyCache.results, "TestApplyIdempotentConcurrent")
+		idempotencyCache.Unlock()
+	}()
+	nms := New(WithIdempotencyKey("TestApplyIdempotentConcurrent"))
+	results := make(chan error, 2)
+	go func() {
+		_, err := nms.applyIdempotent("TestApplyIdempotentConcurrent", "{}", apply)
+		results <- err
+	}()
+	<-started
+	go func() {
+		_, err := nms.applyIdempotent("TestApplyIdempotentConcurrent", "{}", apply)
+		results <- err
+	}()
+	// Give the duplicate time to reach the wait on the first apply.
+	time.Sleep(10 * time.Millisecond)
+	close(unblock)
+	assert.NoError(t, <-results, "must succeed applying")
+	assert.NoError(t, <-results, "must succeed applying the duplicate")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&applies), "a duplicate of an apply in flight must wait for its result")
+}
+
+func TestApplyPerInterfaceIdempotent(t *testing.T) {
+	state := `{"interfaces": [
+  {"name": "dummy1", "type": "dummy", "state": "up"},
+  {"name": "dummy2", "type": "dummy", "state": "up"}
+]}`
+	nms := New(WithIdempotencyKey("TestApplyPerInterfaceIdempotent"))
+	docs, err := splitByInterface(state)
+	assert.NoError(t, err, "must succeed splitting state")
+	// Remember every document as applied, so ApplyPerInterface must only get
+	// them from the cache.
+	for _, doc := range docs {
+		encoded, err := json.Marshal(doc.state)
+		assert.NoError(t, err)
+		_, err = nms.applyIdempotent("TestApplyPerInterfaceIdempotent/"+doc.name, string(encoded), func(state string) (string, error) {
+			return state, nil
+		})
+		assert.NoError(t, err)
+	}
+
+	progress := []string{}
+	_, err = nms.ApplyPerInterface(state, func(iface string, err error) {
+		assert.NoError(t, err, "each document must use its own idempotency key")
+		progress = append(progress, iface)
+	})
+	assert.NoError(t, err, "must succeed applying per interface with an idempotency key")
+	assert.Equal(t, []string{"dummy1", "dummy2"}, progress)
+}
@@ -0,0 +1,201 @@
+package nmstate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type keyfileEntry struct {
+	key   string
+	value string
+	// comment holds comment lines, key is empty for them.
+	comment string
+}
+
+type keyfileSection struct {
+	name    string
+	entries []keyfileEntry
+}
+
+// MergeKeyfile merges a NetworkManager keyfile generated by nmstate into an
+// existing one, for instance a hand-edited file on disk. The rules are:
+//
+//   - Sections of the generated keyfile are written first, in the generated
+//     order. Their keys take the generated values, keys only present in the
+//     existing section, like connection.permissions, are kept after them.
+//   - Numbered keys of an existing section also generated, like address2,
+//     route1 or route1_options, are dropped: nmstate generates these lists
+//     as a whole, so an entry it did not generate is stale. Comments of such
+//     sections are dropped as well as they may describe replaced values.
+//   - Sections only present in the existing keyfile are kept as is,
+//     including their comments, after the generated ones. Custom settings
+//     belong in such sections, for instance [ethtool] or [user].
+//   - Comments before the first section of the existing keyfile are kept on
+//     top.
+//
+// This function returns the merged keyfile or an error when any of the
+// keyfiles has a line which is neither a section, a key or a comment.
+func MergeKeyfile(existing, generated string) (string, error) {
+	existingSections, err := parseKeyfile(existing)
+	if err != nil {
+		return "", fmt.Errorf("failed parsing existing keyfile: %v", err)
+	}
+	generatedSections, err := parseKeyfile(generated)
+	if err != nil {
+		return "", fmt.Errorf("failed parsing generated keyfile: %v", err)
+	}
+
+	existingByName := map[string]keyfileSection{}
+	for _, section := range existingSections {
+		existingByName[section.name] = section
+	}
+	managed := map[string]bool{}
+	merged := []keyfileSection{}
+	if len(existingSections) > 0 && existingSections[0].name == "" {
+		merged = append(merged, existingSections[0])
+		existingSections = existingSections[1:]
+	}
+	for _, section := range generatedSections {
+		managed[section.name] = true
+		keys := map[string]bool{}
+		for _, entry := range section.entries {
+			if entry.key != "" {
+				keys[entry.key] = true
+			}
+		}
+		for _, entry := range existingByName[section.name].entries {
+			if entry.key != "" && !keys[entry.key] && !keyfileListKey.MatchString(entry.key) {
+				section.entries = append(section.entries, entry)
+			}
+		}
+		merged = append(merged, section)
+	}
+	for _, section := range existingSections {
+		if !managed[section.name] {
+			merged = append(merged, section)
+		}
+	}
+	return formatKeyfile(merged), nil
+}
+
+// keyfileListKey matches the keys of numbered lists, like address1, route2
+// or route2_options.
+var keyfileListKey = regexp.MustCompile(`^[a-z-]+[0-9]+(_[a-z-]+)?$`)
+
+func parseKeyfile(content string) ([]keyfileSection, error) {
+	sections := []keyfileSection{}
+	var current *keyfileSection
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";"):
+			if current == nil {
+				sections = append(sections, keyfileSection{})
+				current = &sections[len(sections)-1]
+			}
+			current.entries = append(current.entries, keyfileEntry{comment: trimmed})
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			sections = append(sections, keyfileSection{name: trimmed[1 : len(trimmed)-1]})
+			current = &sections[len(sections)-1]
+		default:
+			key, value, found := cutString(line, "=")
+			key = strings.TrimSpace(key)
+			if !found || key == "" || current == nil || current.name == "" {
+				return nil, fmt.Errorf("invalid line %d: %q", i+1, line)
+			}
+			current.entries = append(current.entries, keyfileEntry{key: key, value: strings.TrimSpace(value)})
+		}
+	}
+	return sections, nil
+}
+
+// diffKeyfiles returns the differences between two keyfiles ignoring
+// comments and ordering, one line per key sorted by section and key:
+// "- section.key: value" for a key only in a, "+ section.key: value" for a
+// key only in b and "~ section.key: value -> value" for a changed one. The
+// values of secret keys are redacted.
+func diffKeyfiles(a, b string) ([]string, error) {
+	valuesA, err := keyfileValues(a)
+	if err != nil {
+		return nil, err
+	}
+	valuesB, err := keyfileValues(b)
+	if err != nil {
+		return nil, err
+	}
+	display := func(key, value string) string {
+		if _, name, _ := cutString(key, "."); secretFields[name] {
+			return redactedValue
+		}
+		return value
+	}
+	lines := []string{}
+	for key, valueA := range valuesA {
+		valueB, ok := valuesB[key]
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("- %s: %s", key, display(key, valueA)))
+		case valueA != valueB:
+			lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", key, display(key, valueA), display(key, valueB)))
+		}
+	}
+	for key, valueB := range valuesB {
+		if _, ok := valuesA[key]; !ok {
+			lines = append(lines, fmt.Sprintf("+ %s: %s", key, display(key, valueB)))
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][2:] < lines[j][2:]
+	})
+	return lines, nil
+}
+
+// keyfileValues indexes the values of a keyfile by "section.key".
+func keyfileValues(content string) (map[string]string, error) {
+	sections, err := parseKeyfile(content)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for _, section := range sections {
+		for _, entry := range section.entries {
+			if entry.key == "" {
+				continue
+			}
+			values[section.name+"."+entry.key] = entry.value
+		}
+	}
+	return values, nil
+}
+
+func formatKeyfile(sections []keyfileSection) string {
+	var b strings.Builder
+	for i, section := range sections {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if section.name != "" {
+			b.WriteString("[" + section.name + "]\n")
+		}
+		for _, entry := range section.entries {
+			if entry.key == "" {
+				b.WriteString(entry.comment + "\n")
+			} else {
+				b.WriteString(entry.key + "=" + entry.value + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// cutString is strings.Cut, which is not available in go 1.16.
+func cutString(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,97 @@
+package nmstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeKeyfile(t *testing.T) {
+	existing := `# Edited by hand
+[connection]
+id=eth1
+type=ethernet
+permissions=user:admin
+
+[ipv4]
+# static address of the old subnet
+method=manual
+address1=198.51.100.10/24
+address2=198.51.100.11/24
+
+[ethtool]
+# keep offloading off
+feature-tso=false
+`
+	generated := `[connection]
+id=eth1
+uuid=5a4bbbc6-8b3e-4fc0-a8f9-6d3ad2d1f8a1
+type=ethernet
+interface-name=eth1
+
+[ipv4]
+method=manual
+address1=192.0.2.10/24
+`
+	merged, err := MergeKeyfile(existing, generated)
+	assert.NoError(t, err, "must succeed merging keyfiles")
+	assert.NotContains(t, merged, "address2=", "generated sections must not keep stale addresses")
+	assert.Equal(t, `# Edited by hand
+
+[connection]
+id=eth1
+uuid=5a4bbbc6-8b3e-4fc0-a8f9-6d3ad2d1f8a1
+type=ethernet
+interface-name=eth1
+permissions=user:admin
+
+[ipv4]
+method=manual
+address1=192.0.2.10/24
+
+[ethtool]
+# keep offloading off
+feature-tso=false
+`, merged)
+}
+
+func TestMergeKeyfileKeepsExistingKeys(t *testing.T) {
+	existing := `[connection]
+id=eth1
+autoconnect-priority=10
+permissions=user:admin
+
+[ipv4]
+method=manual
+address1=198.51.100.10/24
+route1=198.51.100.0/24,198.51.100.1
+route1_options=table=100
+dns-search=example.com
+`
+	generated := `[connection]
+id=eth1
+autoconnect-priority=20
+
+[ipv4]
+method=auto
+`
+	merged, err := MergeKeyfile(existing, generated)
+	assert.NoError(t, err, "must succeed merging keyfiles")
+	assert.Equal(t, `[connection]
+id=eth1
+autoconnect-priority=20
+permissions=user:admin
+
+[ipv4]
+method=auto
+dns-search=example.com
+`, merged, "generated keys must win and other existing keys must be kept, except numbered ones")
+}
+
+func TestMergeKeyfileInvalid(t *testing.T) {
+	_, err := MergeKeyfile("[connection]\nnot a key\n", "[connection]\nid=eth1\n")
+	assert.Error(t, err, "must fail on invalid existing keyfile")
+
+	_, err = MergeKeyfile("", "id=eth1\n")
+	assert.Error(t, err, "must fail on key outside of a section")
+}
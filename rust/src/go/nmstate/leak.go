@@ -0,0 +1,27 @@
+package nmstate
+
+// LeakDiagnostics reports resources held by the binding. Instrumented is
+// false, and OutstandingCStrings always zero, unless the binding is built
+// with the nmstate_leakcheck build tag.
+type LeakDiagnostics struct {
+	Instrumented bool
+	// OutstandingCStrings is the number of C strings, allocated by the
+	// binding or returned by libnmstate, not freed yet across all clients.
+	OutstandingCStrings int64
+	// OutstandingCheckpoints is the number of checkpoints created by this
+	// client with WithNoCommit() and not committed nor rolled back yet.
+	OutstandingCheckpoints int
+}
+
+// DiagnoseLeaks returns the resources currently held by the binding, so long
+// running daemons can detect slow leaks.
+func (n *Nmstate) DiagnoseLeaks() LeakDiagnostics {
+	diagnostics := LeakDiagnostics{
+		Instrumented:        leakCheckInstrumented,
+		OutstandingCStrings: leakCheckOutstanding(),
+	}
+	if n.checkpoint.outstanding() {
+		diagnostics.OutstandingCheckpoints = 1
+	}
+	return diagnostics
+}
@@ -0,0 +1,22 @@
+//go:build nmstate_leakcheck
+// +build nmstate_leakcheck
+
+package nmstate
+
+import "sync/atomic"
+
+const leakCheckInstrumented = true
+
+var outstandingCStrings int64
+
+func leakCheckAlloc() {
+	atomic.AddInt64(&outstandingCStrings, 1)
+}
+
+func leakCheckFree() {
+	atomic.AddInt64(&outstandingCStrings, -1)
+}
+
+func leakCheckOutstanding() int64 {
+	return atomic.LoadInt64(&outstandingCStrings)
+}
@@ -0,0 +1,23 @@
+package nmstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnoseLeaks(t *testing.T) {
+	nms := New(WithNoCommit())
+	nms.RetrieveNetState()
+	nms.GenerateConfiguration(`{"interfaces": [{"name": "dummy1", "state": "up", "type": "dummy"}]}`)
+	nms.ApplyNetState(`{"interfaces": [{"name": "dummy1", "state": "up", "type": "dummy"}]}`)
+	nms.RollbackCheckpoint("")
+
+	diagnostics := nms.DiagnoseLeaks()
+	assert.Equal(t, leakCheckInstrumented, diagnostics.Instrumented)
+	assert.Zero(t, diagnostics.OutstandingCStrings, "all C strings must be freed")
+	assert.Zero(t, diagnostics.OutstandingCheckpoints, "no checkpoint must be left")
+
+	nms.trackCheckpoint("")
+	assert.Equal(t, 1, nms.DiagnoseLeaks().OutstandingCheckpoints, "outstanding checkpoint must be reported")
+}
@@ -0,0 +1,278 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Warning is a likely misconfiguration found in a network state. Rule names
+// the check reporting it and Interfaces the interfaces involved.
+type Warning struct {
+	Rule       string
+	Interfaces []string
+	Message    string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Rule, w.Message)
+}
+
+// CheckMTUConsistency returns a warning for every linux-bridge, ovs-bridge
+// or bond of the network state in json format with an MTU larger than the
+// MTU of one of its ports. Ports not defined in the state or without MTU are
+// not checked.
+func CheckMTUConsistency(state string) ([]Warning, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+	ifaces := stateInterfaces(netState)
+	mtus := map[string]uint64{}
+	for _, iface := range ifaces {
+		if mtu, ok := interfaceMTU(iface); ok {
+			mtus[stringField(iface, "name")] = mtu
+		}
+	}
+	warnings := []Warning{}
+	for _, iface := range ifaces {
+		name := stringField(iface, "name")
+		mtu, ok := interfaceMTU(iface)
+		if !ok {
+			continue
+		}
+		for _, port := range interfacePorts(iface) {
+			portMTU, ok := mtus[port]
+			if ok && portMTU < mtu {
+				warnings = append(warnings, Warning{
+					Rule:       "mtu-consistency",
+					Interfaces: []string{name, port},
+					Message:    fmt.Sprintf("%s MTU %d is larger than the MTU %d of its port %s", name, mtu, portMTU, port),
+				})
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// interfaceMTU returns the MTU of the interface, nmstate accepts it both as
+// number and string.
+func interfaceMTU(iface map[string]interface{}) (uint64, bool) {
+	var value string
+	switch mtu := iface["mtu"].(type) {
+	case json.Number:
+		value = mtu.String()
+	case string:
+		value = mtu
+	default:
+		return 0, false
+	}
+	mtu, err := strconv.ParseUint(value, 10, 64)
+	return mtu, err == nil
+}
+
+// interfacePorts returns the port names of a bridge or bond interface.
+func interfacePorts(iface map[string]interface{}) []string {
+	ports := []string{}
+	switch stringField(iface, "type") {
+	case "linux-bridge", "ovs-bridge":
+		bridge, _ := iface["bridge"].(map[string]interface{})
+		list, _ := bridge["port"].([]interface{})
+		for _, entry := range list {
+			if port, ok := entry.(map[string]interface{}); ok {
+				ports = append(ports, stringField(port, "name"))
+			}
+		}
+	case "bond":
+		bond, _ := iface["link-aggregation"].(map[string]interface{})
+		list, ok := bond["port"].([]interface{})
+		if !ok {
+			list, _ = bond["slaves"].([]interface{})
+		}
+		for _, entry := range list {
+			if port, ok := entry.(string); ok {
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports
+}
+
+// CheckVLANBaseInterfaces returns a warning for every vlan interface of the
+// network state in json format whose base-iface is not defined in the same
+// state, so it has to already exist on the system, or is marked as absent.
+func CheckVLANBaseInterfaces(state string) ([]Warning, error) {
+	return checkVLANBaseInterfaces(state, nil)
+}
+
+// CheckVLANBaseInterfacesWithCurrent is like CheckVLANBaseInterfaces but only
+// warns about base interfaces missing in both the desired state and the
+// current network state, both in json format.
+func CheckVLANBaseInterfacesWithCurrent(state, current string) ([]Warning, error) {
+	currentState, err := decodeState(current)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, iface := range stateInterfaces(currentState) {
+		existing[stringField(iface, "name")] = true
+	}
+	return checkVLANBaseInterfaces(state, existing)
+}
+
+func checkVLANBaseInterfaces(state string, existing map[string]bool) ([]Warning, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+	ifaces := stateInterfaces(netState)
+	states := map[string]string{}
+	for _, iface := range ifaces {
+		states[stringField(iface, "name")] = stringField(iface, "state")
+	}
+	warnings := []Warning{}
+	for _, iface := range ifaces {
+		if stringField(iface, "type") != "vlan" || stringField(iface, "state") == "absent" {
+			continue
+		}
+		name := stringField(iface, "name")
+		vlan, _ := iface["vlan"].(map[string]interface{})
+		base := stringField(vlan, "base-iface")
+		var message string
+		baseState, inState := states[base]
+		switch {
+		case base == "":
+			message = fmt.Sprintf("vlan %s has no base-iface", name)
+		case inState && baseState == "absent":
+			message = fmt.Sprintf("vlan %s base interface %s is marked as absent", name, base)
+		case inState:
+			continue
+		case existing == nil:
+			message = fmt.Sprintf("vlan %s base interface %s is not in the state, it must already exist on the system", name, base)
+		case !existing[base]:
+			message = fmt.Sprintf("vlan %s base interface %s is neither in the state nor on the system", name, base)
+		default:
+			continue
+		}
+		warnings = append(warnings, Warning{
+			Rule:       "vlan-base-interface",
+			Interfaces: []string{name, base},
+			Message:    message,
+		})
+	}
+	return warnings, nil
+}
+
+type interfaceSubnet struct {
+	iface  string
+	subnet *net.IPNet
+}
+
+// CheckOverlappingSubnets returns a warning for every pair of interfaces of
+// the network state in json format with IPv4 or IPv6 static addresses in
+// overlapping subnets. Link-local and loopback addresses are ignored as every
+// interface has them.
+func CheckOverlappingSubnets(state string) ([]Warning, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+	subnets := []interfaceSubnet{}
+	for _, iface := range stateInterfaces(netState) {
+		if stringField(iface, "state") == "absent" {
+			continue
+		}
+		name := stringField(iface, "name")
+		for _, family := range []string{"ipv4", "ipv6"} {
+			ipConfig, _ := iface[family].(map[string]interface{})
+			if enabled, ok := ipConfig["enabled"].(bool); ok && !enabled {
+				continue
+			}
+			addresses, _ := ipConfig["address"].([]interface{})
+			for _, entry := range addresses {
+				address, _ := entry.(map[string]interface{})
+				cidr := fmt.Sprintf("%s/%v", stringField(address, "ip"), address["prefix-length"])
+				ip, subnet, err := net.ParseCIDR(cidr)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s address %s of interface %s: %v", family, cidr, name, err)
+				}
+				if ip.IsLinkLocalUnicast() || ip.IsLoopback() {
+					continue
+				}
+				subnets = append(subnets, interfaceSubnet{name, subnet})
+			}
+		}
+	}
+	warnings := []Warning{}
+	for i, a := range subnets {
+		for _, b := range subnets[i+1:] {
+			if a.iface == b.iface || !subnetsOverlap(a.subnet, b.subnet) {
+				continue
+			}
+			warnings = append(warnings, Warning{
+				Rule:       "overlapping-subnets",
+				Interfaces: []string{a.iface, b.iface},
+				Message:    fmt.Sprintf("%s subnet %s overlaps with %s subnet %s", a.iface, a.subnet, b.iface, b.subnet),
+			})
+		}
+	}
+	return warnings, nil
+}
+
+func subnetsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// CheckDHCPStaticConflict returns a warning for every interface family of
+// the network state in json format enabling dhcp, or autoconf for ipv6,
+// together with static addresses. nmstate keeps both and NetworkManager adds
+// the static addresses on top of the DHCP or autoconf lease, which is often
+// not what was meant when switching an interface to a dynamic method. It is
+// meant for desired states: the current state reports the addresses obtained
+// by DHCP or autoconf as addresses too.
+func CheckDHCPStaticConflict(state string) ([]Warning, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+	warnings := []Warning{}
+	for _, iface := range stateInterfaces(netState) {
+		if stringField(iface, "state") == "absent" {
+			continue
+		}
+		name := stringField(iface, "name")
+		for _, family := range []string{"ipv4", "ipv6"} {
+			ipConfig, _ := iface[family].(map[string]interface{})
+			if enabled, ok := ipConfig["enabled"].(bool); ok && !enabled {
+				continue
+			}
+			dynamic := []string{}
+			for _, method := range []string{"dhcp", "autoconf"} {
+				if method == "autoconf" && family != "ipv6" {
+					continue
+				}
+				if enabled, _ := ipConfig[method].(bool); enabled {
+					dynamic = append(dynamic, method)
+				}
+			}
+			addresses, _ := ipConfig["address"].([]interface{})
+			if len(dynamic) == 0 || len(addresses) == 0 {
+				continue
+			}
+			static := make([]string, 0, len(addresses))
+			for _, entry := range addresses {
+				address, _ := entry.(map[string]interface{})
+				static = append(static, fmt.Sprintf("%s/%v", stringField(address, "ip"), address["prefix-length"]))
+			}
+			warnings = append(warnings, Warning{
+				Rule:       "dhcp-with-static",
+				Interfaces: []string{name},
+				Message: fmt.Sprintf("%s has %s %s enabled, static addresses %s are added on top of the lease",
+					name, family, strings.Join(dynamic, " and "), strings.Join(static, ", ")),
+			})
+		}
+	}
+	return warnings, nil
+}
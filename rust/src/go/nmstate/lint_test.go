@@ -0,0 +1,183 @@
+package nmstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckMTUConsistency(t *testing.T) {
+	warnings, err := CheckMTUConsistency(`{
+"interfaces": [{
+  "name": "br0",
+  "type": "linux-bridge",
+  "mtu": 9000,
+  "bridge": {"port": [{"name": "eth1"}, {"name": "eth2"}]}
+}, {
+  "name": "bond0",
+  "type": "bond",
+  "mtu": "9000",
+  "link-aggregation": {"mode": "active-backup", "port": ["eth3"]}
+},
+  {"name": "eth1", "type": "ethernet", "mtu": 9000},
+  {"name": "eth2", "type": "ethernet", "mtu": 1500},
+  {"name": "eth3", "type": "ethernet", "mtu": 1500}
+]}
+`)
+	assert.NoError(t, err, "must succeed checking MTU consistency")
+	assert.Equal(t, []Warning{{
+		Rule:       "mtu-consistency",
+		Interfaces: []string{"br0", "eth2"},
+		Message:    "br0 MTU 9000 is larger than the MTU 1500 of its port eth2",
+	}, {
+		Rule:       "mtu-consistency",
+		Interfaces: []string{"bond0", "eth3"},
+		Message:    "bond0 MTU 9000 is larger than the MTU 1500 of its port eth3",
+	}}, warnings)
+}
+
+func TestCheckMTUConsistencyConsistent(t *testing.T) {
+	warnings, err := CheckMTUConsistency(`{
+"interfaces": [{
+  "name": "br0",
+  "type": "linux-bridge",
+  "mtu": 1500,
+  "bridge": {"port": [{"name": "eth1"}, {"name": "eth2"}]}
+},
+  {"name": "eth1", "type": "ethernet", "mtu": 9000},
+  {"name": "eth2", "type": "ethernet", "mtu": 1500}
+]}
+`)
+	assert.NoError(t, err, "must succeed checking MTU consistency")
+	assert.Empty(t, warnings, "consistent topology should have no warnings")
+}
+
+const danglingVLANState = `{
+"interfaces": [{
+  "name": "eth1.10",
+  "type": "vlan",
+  "state": "up",
+  "vlan": {"base-iface": "eth1", "id": 10}
+}, {
+  "name": "eth2.20",
+  "type": "vlan",
+  "state": "up",
+  "vlan": {"base-iface": "eth2", "id": 20}
+}, {
+  "name": "eth2",
+  "type": "ethernet",
+  "state": "up"
+}]}
+`
+
+func TestCheckVLANBaseInterfaces(t *testing.T) {
+	warnings, err := CheckVLANBaseInterfaces(danglingVLANState)
+	assert.NoError(t, err, "must succeed checking vlan base interfaces")
+	assert.Equal(t, []Warning{{
+		Rule:       "vlan-base-interface",
+		Interfaces: []string{"eth1.10", "eth1"},
+		Message:    "vlan eth1.10 base interface eth1 is not in the state, it must already exist on the system",
+	}}, warnings)
+}
+
+func TestCheckVLANBaseInterfacesWithCurrent(t *testing.T) {
+	warnings, err := CheckVLANBaseInterfacesWithCurrent(danglingVLANState, `{"interfaces": [{"name": "eth1", "type": "ethernet"}]}`)
+	assert.NoError(t, err, "must succeed checking vlan base interfaces")
+	assert.Empty(t, warnings, "base interface existing on the system should not be reported")
+
+	warnings, err = CheckVLANBaseInterfacesWithCurrent(danglingVLANState, `{"interfaces": []}`)
+	assert.NoError(t, err, "must succeed checking vlan base interfaces")
+	assert.Equal(t, []Warning{{
+		Rule:       "vlan-base-interface",
+		Interfaces: []string{"eth1.10", "eth1"},
+		Message:    "vlan eth1.10 base interface eth1 is neither in the state nor on the system",
+	}}, warnings)
+}
+
+func TestCheckOverlappingSubnets(t *testing.T) {
+	warnings, err := CheckOverlappingSubnets(`{
+"interfaces": [{
+  "name": "eth1",
+  "ipv4": {"enabled": true, "address": [{"ip": "192.0.2.10", "prefix-length": 24}]},
+  "ipv6": {"enabled": true, "address": [
+    {"ip": "2001:db8::10", "prefix-length": 64},
+    {"ip": "fe80::1", "prefix-length": 64}
+  ]}
+}, {
+  "name": "eth2",
+  "ipv4": {"enabled": true, "address": [{"ip": "192.0.2.130", "prefix-length": 25}]},
+  "ipv6": {"enabled": true, "address": [
+    {"ip": "2001:db8::20", "prefix-length": 48},
+    {"ip": "fe80::2", "prefix-length": 64}
+  ]}
+}]}
+`)
+	assert.NoError(t, err, "must succeed checking overlapping subnets")
+	assert.Equal(t, []Warning{{
+		Rule:       "overlapping-subnets",
+		Interfaces: []string{"eth1", "eth2"},
+		Message:    "eth1 subnet 192.0.2.0/24 overlaps with eth2 subnet 192.0.2.128/25",
+	}, {
+		Rule:       "overlapping-subnets",
+		Interfaces: []string{"eth1", "eth2"},
+		Message:    "eth1 subnet 2001:db8::/64 overlaps with eth2 subnet 2001:db8::/48",
+	}}, warnings)
+}
+
+func TestCheckOverlappingSubnetsDisjoint(t *testing.T) {
+	warnings, err := CheckOverlappingSubnets(`{
+"interfaces": [{
+  "name": "eth1",
+  "ipv4": {"enabled": true, "address": [{"ip": "192.0.2.10", "prefix-length": 25}]},
+  "ipv6": {"enabled": true, "address": [{"ip": "2001:db8:1::10", "prefix-length": 64}]}
+}, {
+  "name": "eth2",
+  "ipv4": {"enabled": true, "address": [{"ip": "192.0.2.130", "prefix-length": 25}]},
+  "ipv6": {"enabled": true, "address": [{"ip": "2001:db8:2::10", "prefix-length": 64}]}
+}]}
+`)
+	assert.NoError(t, err, "must succeed checking overlapping subnets")
+	assert.Empty(t, warnings, "disjoint subnets should have no warnings")
+}
+
+func TestCheckDHCPStaticConflict(t *testing.T) {
+	warnings, err := CheckDHCPStaticConflict(`{"interfaces": [
+  {"name": "eth1", "type": "ethernet", "state": "up",
+   "ipv4": {"enabled": true, "dhcp": true, "address": [{"ip": "192.0.2.10", "prefix-length": 24}]},
+   "ipv6": {"enabled": true, "dhcp": true, "autoconf": true, "address": [{"ip": "2001:db8::10", "prefix-length": 64}]}},
+  {"name": "eth2", "type": "ethernet", "state": "up",
+   "ipv6": {"enabled": true, "autoconf": true, "address": [{"ip": "2001:db8:1::10", "prefix-length": 64}]}}
+]}`)
+	assert.NoError(t, err, "must succeed checking dhcp and static addresses")
+	assert.Equal(t, []Warning{
+		{
+			Rule:       "dhcp-with-static",
+			Interfaces: []string{"eth1"},
+			Message:    "eth1 has ipv4 dhcp enabled, static addresses 192.0.2.10/24 are added on top of the lease",
+		},
+		{
+			Rule:       "dhcp-with-static",
+			Interfaces: []string{"eth1"},
+			Message:    "eth1 has ipv6 dhcp and autoconf enabled, static addresses 2001:db8::10/64 are added on top of the lease",
+		},
+		{
+			Rule:       "dhcp-with-static",
+			Interfaces: []string{"eth2"},
+			Message:    "eth2 has ipv6 autoconf enabled, static addresses 2001:db8:1::10/64 are added on top of the lease",
+		},
+	}, warnings)
+}
+
+func TestCheckDHCPStaticConflictClean(t *testing.T) {
+	warnings, err := CheckDHCPStaticConflict(`{"interfaces": [
+  {"name": "eth1", "type": "ethernet", "state": "up",
+   "ipv4": {"enabled": true, "dhcp": false, "address": [{"ip": "192.0.2.10", "prefix-length": 24}]},
+   "ipv6": {"enabled": true, "dhcp": true, "autoconf": true}},
+  {"name": "eth2", "type": "ethernet", "state": "up",
+   "ipv4": {"enabled": false, "dhcp": true, "address": [{"ip": "192.0.2.20", "prefix-length": 24}]}},
+  {"name": "eth3", "state": "absent",
+   "ipv4": {"dhcp": true, "address": [{"ip": "192.0.2.30", "prefix-length": 24}]}}
+]}`)
+	assert.NoError(t, err, "must succeed checking dhcp and static addresses")
+	assert.Empty(t, warnings)
+}
@@ -0,0 +1,48 @@
+package nmstate
+
+import "fmt"
+
+// LLDPNeighbor is a neighbor reported by LLDP on an interface.
+type LLDPNeighbor struct {
+	ChassisID  string
+	PortID     string
+	SystemName string
+}
+
+// LLDPNeighbors returns the LLDP neighbors of each interface of the network
+// state in json format, indexed by interface name. nmstate only reports
+// neighbors of interfaces with LLDP enabled, an empty map is returned when
+// there is none.
+func LLDPNeighbors(state string) (map[string][]LLDPNeighbor, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+	neighbors := map[string][]LLDPNeighbor{}
+	for _, iface := range stateInterfaces(netState) {
+		name := stringField(iface, "name")
+		lldp, _ := iface["lldp"].(map[string]interface{})
+		list, _ := lldp["neighbors"].([]interface{})
+		for _, entry := range list {
+			tlvs, ok := entry.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid LLDP neighbor of interface %s: %v", name, entry)
+			}
+			neighbor := LLDPNeighbor{}
+			for _, tlv := range tlvs {
+				fields, _ := tlv.(map[string]interface{})
+				if value := stringField(fields, "chassis-id"); value != "" {
+					neighbor.ChassisID = value
+				}
+				if value := stringField(fields, "port-id"); value != "" {
+					neighbor.PortID = value
+				}
+				if value := stringField(fields, "system-name"); value != "" {
+					neighbor.SystemName = value
+				}
+			}
+			neighbors[name] = append(neighbors[name], neighbor)
+		}
+	}
+	return neighbors, nil
+}
@@ -0,0 +1,39 @@
+package nmstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLLDPNeighbors(t *testing.T) {
+	neighbors, err := LLDPNeighbors(`{
+"interfaces": [{
+  "name": "eth1",
+  "type": "ethernet",
+  "lldp": {
+    "enabled": true,
+    "neighbors": [[
+      {"type": 5, "system-name": "switch1"},
+      {"type": 6, "system-description": "Example switch"},
+      {"_description": "MAC address", "chassis-id-type": 4, "type": 1, "chassis-id": "00:11:22:33:44:55"},
+      {"_description": "Interface name", "port-id-type": 5, "type": 2, "port-id": "Ethernet1/1"}
+    ]]
+  }
+}, {
+  "name": "eth2",
+  "type": "ethernet",
+  "lldp": {"enabled": false}
+}]}
+`)
+	assert.NoError(t, err, "must succeed parsing LLDP neighbors")
+	assert.Equal(t, map[string][]LLDPNeighbor{
+		"eth1": {{ChassisID: "00:11:22:33:44:55", PortID: "Ethernet1/1", SystemName: "switch1"}},
+	}, neighbors)
+}
+
+func TestLLDPNeighborsAbsent(t *testing.T) {
+	neighbors, err := LLDPNeighbors(`{"interfaces": [{"name": "eth1", "type": "ethernet"}]}`)
+	assert.NoError(t, err, "must succeed parsing state without LLDP")
+	assert.Empty(t, neighbors, "state without LLDP should have no neighbors")
+}
@@ -0,0 +1,144 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+)
+
+// ApplyNetStateFromFiles reads the network states in json format stored in
+// the files provided, merges them and applies the result. Interfaces with the
+// same name and type, or the same name and no type in one of the files, are
+// merged property by property. Interfaces of different types may only share
+// a name when nmstate allows it, like an ovs-bridge and its ovs-interface.
+// Routes, route rules and DNS lists are concatenated dropping duplicated
+// entries. A property set to different values in two files is an error. This
+// function returns the applied network state or an error.
+func (n *Nmstate) ApplyNetStateFromFiles(paths ...string) (string, error) {
+	state, err := mergeStateFiles(paths...)
+	if err != nil {
+		return "", err
+	}
+	return n.ApplyNetState(state)
+}
+
+func mergeStateFiles(paths ...string) (string, error) {
+	if len(paths) == 0 {
+		return "", fmt.Errorf("no state file provided")
+	}
+	merged := map[string]interface{}{}
+	ifaces := []interface{}{}
+	ifacesByName := map[string][]map[string]interface{}{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed reading state file: %v", err)
+		}
+		netState, err := decodeState(string(content))
+		if err != nil {
+			return "", fmt.Errorf("failed reading state file %s: %v", path, err)
+		}
+		for _, iface := range stateInterfaces(netState) {
+			name := stringField(iface, "name")
+			existing, err := mergeTarget(ifacesByName[name], stringField(iface, "type"))
+			if err != nil {
+				return "", fmt.Errorf("failed merging state file %s: interface %s %v", path, name, err)
+			}
+			if existing == nil {
+				ifacesByName[name] = append(ifacesByName[name], iface)
+				ifaces = append(ifaces, iface)
+				continue
+			}
+			if err := mergeObjects(existing, iface, "interface "+name, false); err != nil {
+				return "", fmt.Errorf("failed merging state file %s: %v", path, err)
+			}
+		}
+		delete(netState, "interfaces")
+		if err := mergeObjects(merged, netState, "state", true); err != nil {
+			return "", fmt.Errorf("failed merging state file %s: %v", path, err)
+		}
+	}
+	if len(ifaces) > 0 {
+		merged["interfaces"] = ifaces
+	}
+	state, err := json.Marshal(merged)
+	if err != nil {
+		return "", fmt.Errorf("failed encoding merged state: %v", err)
+	}
+	return string(state), nil
+}
+
+// mergeTarget returns the interface of entries, all sharing a name, an
+// interface of type ifType is merged into, or nil when it is a new interface.
+func mergeTarget(entries []map[string]interface{}, ifType string) (map[string]interface{}, error) {
+	for _, entry := range entries {
+		if stringField(entry, "type") == ifType {
+			return entry, nil
+		}
+	}
+	if len(entries) == 1 && (ifType == "" || stringField(entries[0], "type") == "") {
+		return entries[0], nil
+	}
+	if ifType == "" {
+		return nil, fmt.Errorf("needs a type to be told apart from the interfaces of the same name")
+	}
+	for _, entry := range entries {
+		if entryType := stringField(entry, "type"); !sharedNameTypes(entryType, ifType) {
+			return nil, fmt.Errorf("has conflicting types %s and %s", entryType, ifType)
+		}
+	}
+	return nil, nil
+}
+
+// sharedNameTypes tells whether interfaces of types a and b may have the
+// same name.
+func sharedNameTypes(a, b string) bool {
+	return (a == "ovs-bridge" && b == "ovs-interface") || (a == "ovs-interface" && b == "ovs-bridge")
+}
+
+// mergeObjects merges src into dst. Lists are concatenated without
+// duplicates when concatLists is set, other values must be identical.
+func mergeObjects(dst, src map[string]interface{}, path string, concatLists bool) error {
+	for key, value := range src {
+		current, ok := dst[key]
+		if !ok {
+			dst[key] = value
+			continue
+		}
+		currentObject, currentIsObject := current.(map[string]interface{})
+		valueObject, valueIsObject := value.(map[string]interface{})
+		if currentIsObject && valueIsObject {
+			if err := mergeObjects(currentObject, valueObject, path+"."+key, concatLists); err != nil {
+				return err
+			}
+			continue
+		}
+		currentList, currentIsList := current.([]interface{})
+		valueList, valueIsList := value.([]interface{})
+		if concatLists && currentIsList && valueIsList {
+			dst[key] = appendUnique(currentList, valueList)
+			continue
+		}
+		if !reflect.DeepEqual(current, value) {
+			return fmt.Errorf("conflicting values for %s.%s: %v and %v", path, key, current, value)
+		}
+	}
+	return nil
+}
+
+func appendUnique(list, values []interface{}) []interface{} {
+	for _, value := range values {
+		found := false
+		for _, entry := range list {
+			if reflect.DeepEqual(entry, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,104 @@
+package nmstate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeStateFiles(t *testing.T, files map[string]string) []string {
+	dir := t.TempDir()
+	paths := []string{}
+	for _, name := range []string{"interfaces.json", "routes.json", "dns.json"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestMergeStateFiles(t *testing.T) {
+	paths := writeStateFiles(t, map[string]string{
+		"interfaces.json": `{
+"interfaces": [{"name": "dummy1", "type": "dummy", "state": "up"}],
+"routes": {"config": [{"destination": "198.51.100.0/24", "next-hop-interface": "dummy1"}]}
+}`,
+		"routes.json": `{
+"interfaces": [{"name": "dummy1", "mtu": 9000}],
+"routes": {"config": [
+  {"destination": "198.51.100.0/24", "next-hop-interface": "dummy1"},
+  {"destination": "203.0.113.0/24", "next-hop-interface": "dummy1"}
+]}
+}`,
+		"dns.json": `{"dns-resolver": {"config": {"server": ["192.0.2.53"]}}}`,
+	})
+	state, err := mergeStateFiles(paths...)
+	assert.NoError(t, err, "must succeed merging state files")
+	assert.JSONEq(t, `{
+"interfaces": [{"name": "dummy1", "type": "dummy", "state": "up", "mtu": 9000}],
+"routes": {"config": [
+  {"destination": "198.51.100.0/24", "next-hop-interface": "dummy1"},
+  {"destination": "203.0.113.0/24", "next-hop-interface": "dummy1"}
+]},
+"dns-resolver": {"config": {"server": ["192.0.2.53"]}}
+}`, state)
+}
+
+func TestMergeStateFilesOVS(t *testing.T) {
+	paths := writeStateFiles(t, map[string]string{
+		"interfaces.json": `{"interfaces": [
+  {"name": "br0", "type": "ovs-bridge", "state": "up", "bridge": {"port": [{"name": "br0"}]}},
+  {"name": "br0", "type": "ovs-interface", "state": "up"}
+]}`,
+		"routes.json": `{"interfaces": [{"name": "br0", "type": "ovs-interface", "mtu": 9000}]}`,
+	})
+	state, err := mergeStateFiles(paths...)
+	assert.NoError(t, err, "must succeed merging an ovs-bridge and its ovs-interface")
+	assert.JSONEq(t, `{"interfaces": [
+  {"name": "br0", "type": "ovs-bridge", "state": "up", "bridge": {"port": [{"name": "br0"}]}},
+  {"name": "br0", "type": "ovs-interface", "state": "up", "mtu": 9000}
+]}`, state)
+}
+
+func TestMergeStateFilesErrors(t *testing.T) {
+	paths := writeStateFiles(t, map[string]string{
+		"interfaces.json": `{"interfaces": [{"name": "dummy1", "type": "dummy", "mtu": 1500}]}`,
+		"routes.json":     `{"interfaces": [{"name": "dummy1", "type": "dummy", "mtu": 9000}]}`,
+	})
+	_, err := mergeStateFiles(paths...)
+	assert.Error(t, err, "must fail merging conflicting interfaces")
+	assert.Contains(t, err.Error(), "routes.json", "error must name the conflicting file")
+
+	paths = writeStateFiles(t, map[string]string{
+		"interfaces.json": `{"interfaces": [{"name": "eth1", "type": "ethernet", "state": "up"}]}`,
+		"routes.json":     `{"interfaces": [{"name": "eth1", "type": "dummy", "mtu": 9000}]}`,
+	})
+	_, err = mergeStateFiles(paths...)
+	assert.Error(t, err, "must fail merging interfaces of different types")
+	assert.Contains(t, err.Error(), "conflicting types ethernet and dummy", "error must report the type mismatch")
+
+	paths = writeStateFiles(t, map[string]string{
+		"interfaces.json": `{"interfaces": [
+  {"name": "br0", "type": "ovs-bridge", "bridge": {"port": [{"name": "br0"}]}},
+  {"name": "br0", "type": "ovs-interface"}
+]}`,
+		"routes.json": `{"interfaces": [{"name": "br0", "mtu": 9000}]}`,
+	})
+	_, err = mergeStateFiles(paths...)
+	assert.Error(t, err, "must fail merging an interface without type matching several interfaces")
+	assert.Contains(t, err.Error(), "needs a type", "error must ask for the interface type")
+
+	paths = writeStateFiles(t, map[string]string{
+		"interfaces.json": `{"interfaces": []}`,
+		"dns.json":        `{"dns-resolver": `,
+	})
+	_, err = mergeStateFiles(paths...)
+	assert.Error(t, err, "must fail merging invalid json")
+	assert.Contains(t, err.Error(), "dns.json", "error must name the invalid file")
+}
@@ -0,0 +1,51 @@
+package nmstate
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Mismatch is a single property nmstate verification found different from
+// the desired state after applying it. Expected and Actual hold the json of
+// the desired and current values. Interface is empty for mismatches outside
+// of the interfaces section, like ovsdb.
+type Mismatch struct {
+	Interface string
+	Field     string
+	Expected  string
+	Actual    string
+}
+
+// MismatchReport is the structured form of a verification error message.
+// Raw always holds the message parsed, Mismatches is empty when it does not
+// follow the "Verification failure: ..." format.
+type MismatchReport struct {
+	Mismatches []Mismatch
+	Raw        string
+}
+
+var verificationFailureRegexp = regexp.MustCompile(`Verification failure: (\S+) desire '(.*?)', current '(.*?)'(?:, err_kind: |$)`)
+
+const interfaceReference = ".interface"
+
+// ParseMismatchReport parses the verification failure reported by
+// libnmstate, either the err_msg alone or the error returned by
+// ApplyNetState which embeds it.
+func ParseMismatchReport(errMsg string) MismatchReport {
+	report := MismatchReport{Raw: errMsg}
+	for _, match := range verificationFailureRegexp.FindAllStringSubmatch(errMsg, -1) {
+		mismatch := Mismatch{
+			Field:    match[1],
+			Expected: match[2],
+			Actual:   match[3],
+		}
+		// Interface names may contain dots, like VLANs, so split on the
+		// ".interface" marker nmstate puts after the interface name.
+		if i := strings.Index(match[1], interfaceReference); i > 0 {
+			mismatch.Interface = match[1][:i]
+			mismatch.Field = strings.TrimPrefix(match[1][i+len(interfaceReference):], ".")
+		}
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+	return report
+}
@@ -0,0 +1,33 @@
+package nmstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMismatchReport(t *testing.T) {
+	errMsg := `failed applying nmstate net state {} with rc: 1, err_msg: Verification failure: eth1.10.interface.ipv4.address desire '[{"ip":"192.0.2.1","prefix-length":24}]', current '[]', err_kind: VerificationError`
+	report := ParseMismatchReport(errMsg)
+	assert.Equal(t, errMsg, report.Raw)
+	assert.Equal(t, []Mismatch{{
+		Interface: "eth1.10",
+		Field:     "ipv4.address",
+		Expected:  `[{"ip":"192.0.2.1","prefix-length":24}]`,
+		Actual:    "[]",
+	}}, report.Mismatches)
+
+	report = ParseMismatchReport(`Verification failure: ovsdb.external_ids.foo desire '"bar"', current 'null'`)
+	assert.Equal(t, []Mismatch{{
+		Field:    "ovsdb.external_ids.foo",
+		Expected: `"bar"`,
+		Actual:   "null",
+	}}, report.Mismatches)
+}
+
+func TestParseMismatchReportUnparsable(t *testing.T) {
+	errMsg := "Desired route 0.0.0.0/0 not found after apply"
+	report := ParseMismatchReport(errMsg)
+	assert.Empty(t, report.Mismatches, "unknown message must not produce mismatches")
+	assert.Equal(t, errMsg, report.Raw, "raw message must be kept")
+}
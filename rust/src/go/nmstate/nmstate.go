@@ -6,8 +6,13 @@ package nmstate
 // #include <stdlib.h>
 import "C"
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,8 +20,47 @@ type Nmstate struct {
 	timeout    uint
 	logsWriter io.Writer
 	flags      byte
+	requestID  string
+	traceID    string
+	spanID     string
+	// optionErr is an invalid option value reported by every operation.
+	optionErr error
+
+	skipExistingConfigs bool
+	stripReadOnly       bool
+	ignoreMissingAbsent bool
+	managedInterfaces   map[string]bool
+	jsonIndent          string
+	rollbackTarget      string
+	rollbackTimeout     time.Duration
+	commitDelay         time.Duration
+	idempotencyKey      string
+	idempotencyTTL      time.Duration
+	// sleep replaces time.Sleep in tests.
+	sleep func(time.Duration)
+
+	// checkpoint is shared with the copies made by WithLogWriterOverride.
+	checkpoint *checkpointState
+
+	// onCall, when set, is called with the operation name and the flags
+	// right before each libnmstate call, flags are 0 for the calls not taking
+	// any.
+	onCall       func(op string, flags uint32)
+	callRecorder io.Writer
 }
 
+// ErrRetrieveTimeout is returned by RetrieveNetState when libnmstate did not
+// answer within the timeout configured with WithTimeout.
+var ErrRetrieveTimeout = errors.New("timed out retrieving net state")
+
+const (
+	retrieveOp = "retrieve"
+	applyOp    = "apply"
+	commitOp   = "commit"
+	rollbackOp = "rollback"
+	genconfOp  = "generate-configuration"
+)
+
 const (
 	kernelOnly = 2 << iota
 	noVerify
@@ -28,7 +72,7 @@ const (
 )
 
 func New(options ...func(*Nmstate)) *Nmstate {
-	nms := &Nmstate{}
+	nms := &Nmstate{checkpoint: &checkpointState{}}
 	for _, option := range options {
 		option(nms)
 	}
@@ -47,6 +91,148 @@ func WithLogsWritter(log_writter io.Writer) func(*Nmstate) {
 	}
 }
 
+// WithRequestID prefixes every log line written to the logs writer with the
+// provided request ID, so operations can be correlated across services.
+func WithRequestID(id string) func(*Nmstate) {
+	return func(n *Nmstate) {
+		n.requestID = id
+	}
+}
+
+// WithSkipExistingConfigs makes WriteGeneratedConfigs keep configuration
+// files already present in the target directory instead of overwriting them.
+func WithSkipExistingConfigs() func(*Nmstate) {
+	return func(n *Nmstate) {
+		n.skipExistingConfigs = true
+	}
+}
+
+// WithStripReadOnlyOnApply removes the properties nmstate only reports and
+// ignores on apply (see StripReadOnly) from the desired state before applying
+// it, so a retrieved state can be applied back as is.
+func WithStripReadOnlyOnApply() func(*Nmstate) {
+	return func(n *Nmstate) {
+		n.stripReadOnly = true
+	}
+}
+
+// WithJSONIndent indents the json network state returned by RetrieveNetState
+// and ApplyNetState with the indent provided, for instance two spaces.
+func WithJSONIndent(indent string) func(*Nmstate) {
+	return func(n *Nmstate) {
+		n.jsonIndent = indent
+	}
+}
+
+// WithRollbackIfUnreachable makes ApplyNetState apply without committing,
+// then try to open a TCP connection to target, in the "host:port" form, for
+// up to timeout. The change is committed once the target answers and rolled
+// back with ErrTargetUnreachable otherwise. timeout must be shorter than the
+// checkpoint timeout set with WithTimeout, if any.
+func WithRollbackIfUnreachable(target string, timeout time.Duration) func(*Nmstate) {
+	return func(n *Nmstate) {
+		n.rollbackTarget = target
+		n.rollbackTimeout = timeout
+	}
+}
+
+// WithTraceContext prefixes every log line written to the logs writer with
+// the trace and span IDs of a W3C trace context, so operations can be
+// correlated with distributed traces. traceID must be 32 and spanID 16 lower
+// case hex characters, not all zeros, otherwise every operation fails.
+func WithTraceContext(traceID, spanID string) func(*Nmstate) {
+	return func(n *Nmstate) {
+		if !validTraceContextID(traceID, 32) || !validTraceContextID(spanID, 16) {
+			n.optionErr = fmt.Errorf("invalid trace context, trace ID %q, span ID %q", traceID, spanID)
+			return
+		}
+		n.traceID = traceID
+		n.spanID = spanID
+	}
+}
+
+func validTraceContextID(id string, length int) bool {
+	if len(id) != length || strings.Trim(id, "0") == "" {
+		return false
+	}
+	for _, c := range id {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// WithIgnoreMissingAbsent removes the interfaces marked as absent in the
+// desired state which do not exist in the current network state before
+// applying, making them a no-op. Without it the desired state is sent as is
+// and, depending on the libnmstate version, such interfaces are either
+// ignored or fail the apply.
+func WithIgnoreMissingAbsent() func(*Nmstate) {
+	return func(n *Nmstate) {
+		n.ignoreMissingAbsent = true
+	}
+}
+
+// WithCommitDelay makes ApplyNoVerifyThenCheck and WithRollbackIfUnreachable
+// applies wait for delay once the change is accepted before committing it,
+// letting links and DHCP settle. The delay plus the connectivity check
+// timeout must be shorter than the checkpoint timeout set with WithTimeout,
+// after which NetworkManager rolls the change back on its own.
+func WithCommitDelay(delay time.Duration) func(*Nmstate) {
+	return func(n *Nmstate) {
+		n.commitDelay = delay
+	}
+}
+
+// WithManagedInterfaces restricts every apply of the client, including
+// ApplyNoVerifyThenCheck and SupportsFeature, to desired states only
+// referencing the interfaces named: as interface, controller, port, veth peer
+// or base interface, route next-hop-interface, route rule iif or IPv6
+// link-local DNS server interface. Other desired states are rejected before
+// reaching libnmstate.
+func WithManagedInterfaces(names ...string) func(*Nmstate) {
+	return func(n *Nmstate) {
+		n.managedInterfaces = map[string]bool{}
+		for _, name := range names {
+			n.managedInterfaces[name] = true
+		}
+	}
+}
+
+// WithCallRecorder writes a CallRecord as a json line to w before each
+// libnmstate call, with the secrets of the input state redacted. The
+// recording can be read back with ParseCallRecording and replayed against a
+// fake with ReplayCalls to reproduce an issue.
+func WithCallRecorder(w io.Writer) func(*Nmstate) {
+	return func(n *Nmstate) {
+		n.callRecorder = w
+	}
+}
+
+// WithIdempotencyKey makes ApplyNetState remember its successful result under
+// key and return it, without applying again, for a later call with the same
+// key within the TTL set by WithIdempotencyTTL, defaulting to 5 minutes.
+// Reusing a key with a different state or client options is an error, the
+// key only covers the state of a single ApplyNetState call, see
+// ApplyPerInterface for splitting a state. A call with a key being applied
+// waits for that apply. Results are kept in memory, shared by all the clients
+// of the process and lost when it exits; failed applies are not kept so they
+// can be retried.
+func WithIdempotencyKey(key string) func(*Nmstate) {
+	return func(n *Nmstate) {
+		n.idempotencyKey = key
+	}
+}
+
+// WithIdempotencyTTL sets how long the result of an apply made with
+// WithIdempotencyKey is remembered.
+func WithIdempotencyTTL(ttl time.Duration) func(*Nmstate) {
+	return func(n *Nmstate) {
+		n.idempotencyTTL = ttl
+	}
+}
+
 func WithKernelOnly() func(*Nmstate) {
 	return func(n *Nmstate) {
 		n.flags = n.flags | kernelOnly
@@ -65,6 +251,10 @@ func WithIncludeStatusData() func(*Nmstate) {
 	}
 }
 
+// WithIncludeSecrets keeps the secrets, like passwords, psk and the mka-cak
+// of macsec interfaces, in the retrieved state and in the state returned by
+// an apply, otherwise replaced by nmstate's placeholder. macsec interfaces
+// are not supported by the bundled libnmstate yet.
 func WithIncludeSecrets() func(*Nmstate) {
 	return func(n *Nmstate) {
 		n.flags = n.flags | includeSecrets
@@ -90,54 +280,216 @@ func WithRunningConfigOnly() func(*Nmstate) {
 }
 
 // Retrieve the network state in json format. This function returns the current
-// network state or an error.
+// network state or an error. When a timeout is set with WithTimeout it fails
+// with ErrRetrieveTimeout if libnmstate takes longer, the abandoned call
+// keeps running in the background until libnmstate returns and its logs are
+// dropped.
 func (n *Nmstate) RetrieveNetState() (string, error) {
+	if n.optionErr != nil {
+		return "", n.optionErr
+	}
+	flags := n.flags
+	if err := n.recordCall(retrieveOp, flags, ""); err != nil {
+		return "", err
+	}
+	call := func() retrieveResult {
+		return retrieveNetState(flags)
+	}
+	var result retrieveResult
+	if n.timeout == 0 {
+		result = call()
+	} else {
+		result = runWithTimeout(time.Duration(n.timeout)*time.Second, call)
+	}
+	if result.err != nil {
+		return "", result.err
+	}
+	if err := n.writeLog(result.log); err != nil {
+		return "", fmt.Errorf("failed when retrieving state: %v", err)
+	}
+	return n.indentJSON(result.state), nil
+}
+
+// kindError is a libnmstate failure carrying its error kind, for instance
+// NotSupportedError.
+type kindError struct {
+	kind string
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+// retrieveResult is the outcome of a libnmstate retrieve call.
+type retrieveResult struct {
+	state string
+	log   string
+	err   error
+}
+
+// runWithTimeout runs call in a goroutine and waits for it at most timeout.
+// call must not use the client: it keeps running after a timeout, when
+// nobody reads its result anymore.
+func runWithTimeout(timeout time.Duration, call func() retrieveResult) retrieveResult {
+	done := make(chan retrieveResult, 1)
+	go func() {
+		done <- call()
+	}()
+	select {
+	case result := <-done:
+		return result
+	case <-time.After(timeout):
+		return retrieveResult{err: fmt.Errorf("%w after %v", ErrRetrieveTimeout, timeout)}
+	}
+}
+
+func retrieveNetState(flags byte) retrieveResult {
 	var (
 		state    *C.char
 		log      *C.char
 		err_kind *C.char
 		err_msg  *C.char
 	)
-	rc := C.nmstate_net_state_retrieve(C.uint(n.flags), &state, &log, &err_kind, &err_msg)
+	rc := C.nmstate_net_state_retrieve(C.uint(flags), &state, &log, &err_kind, &err_msg)
+	trackCStrings(state, log, err_kind, err_msg)
 	defer func() {
-		C.nmstate_cstring_free(state)
-		C.nmstate_cstring_free(err_msg)
-		C.nmstate_cstring_free(err_kind)
-		C.nmstate_cstring_free(log)
+		freeCString(state)
+		freeCString(err_msg)
+		freeCString(err_kind)
+		freeCString(log)
 	}()
 	if rc != 0 {
-		return "", fmt.Errorf("failed retrieving nmstate net state with rc: %d, err_msg: %s, err_kind: %s", rc, C.GoString(err_msg), C.GoString(err_kind))
+		return retrieveResult{err: fmt.Errorf("failed retrieving nmstate net state with rc: %d, err_msg: %s, err_kind: %s", rc, C.GoString(err_msg), C.GoString(err_kind))}
 	}
-	if err := n.writeLog(log); err != nil {
-		return "", fmt.Errorf("failed when retrieving state: %v", err)
+	return retrieveResult{state: C.GoString(state), log: C.GoString(log)}
+}
+
+// RetrieveWithEthtool retrieves the network state in json format including
+// the ethtool data (features, pause, ring, coalesce) of each interface.
+// The ethtool data is queried from the kernel so no extra flag is needed and
+// it is also reported together with WithKernelOnly(); interfaces without
+// ethtool support, like loopback, do not have it.
+func (n *Nmstate) RetrieveWithEthtool() (string, error) {
+	return n.RetrieveNetState()
+}
+
+// RetrieveByType retrieves the network state in json format holding only the
+// interfaces of type ifType, like "bond" or "linux-bridge". libnmstate has no
+// such filter so the complete state is retrieved and filtered.
+func (n *Nmstate) RetrieveByType(ifType string) (string, error) {
+	state, err := n.RetrieveNetState()
+	if err != nil {
+		return "", err
 	}
-	return C.GoString(state), nil
+	return filterInterfacesByType(state, ifType)
 }
 
 // Apply the network state in json format. This function returns the applied
-// network state or an error.
+// network state or an error. It fails with ErrCheckpointExists while a
+// checkpoint from a previous WithNoCommit() apply is outstanding.
 func (n *Nmstate) ApplyNetState(state string) (string, error) {
+	return n.applyWithKey(n.idempotencyKey, state)
+}
+
+// applyWithKey applies the state remembering its result under the
+// idempotency key provided, if any.
+func (n *Nmstate) applyWithKey(key, state string) (string, error) {
+	if key != "" {
+		return n.applyIdempotent(key, state, n.applyDesiredState)
+	}
+	return n.applyDesiredState(state)
+}
+
+func (n *Nmstate) applyDesiredState(state string) (string, error) {
+	if n.rollbackTarget != "" {
+		return n.applyIfReachable(state)
+	}
+	return n.applyNetState(state, n.flags)
+}
+
+func (n *Nmstate) applyNetState(state string, flags byte) (string, error) {
 	var (
 		c_state  *C.char
 		log      *C.char
 		err_kind *C.char
 		err_msg  *C.char
 	)
-	c_state = C.CString(state)
-	rc := C.nmstate_net_state_apply(C.uint(n.flags), c_state, C.uint(n.timeout), &log, &err_kind, &err_msg)
+	if n.optionErr != nil {
+		return "", n.optionErr
+	}
+	if err := n.checkOutstandingCheckpoint(); err != nil {
+		return "", err
+	}
+	state, err := n.prepareApply(state)
+	if err != nil {
+		return "", err
+	}
+	if err := n.recordCall(applyOp, flags, state); err != nil {
+		return "", err
+	}
+	c_state = newCString(state)
+	rc := C.nmstate_net_state_apply(C.uint(flags), c_state, C.uint(n.timeout), &log, &err_kind, &err_msg)
+	trackCStrings(log, err_kind, err_msg)
 
 	defer func() {
-		C.nmstate_cstring_free(c_state)
-		C.nmstate_cstring_free(err_msg)
-		C.nmstate_cstring_free(err_kind)
-		C.nmstate_cstring_free(log)
+		freeCString(c_state)
+		freeCString(err_msg)
+		freeCString(err_kind)
+		freeCString(log)
 	}()
+	secrets := secretValues(state)
 	if rc != 0 {
-		return "", fmt.Errorf("failed applying nmstate net state %s with rc: %d, err_msg: %s, err_kind: %s", state, rc, C.GoString(err_msg), C.GoString(err_kind))
+		return "", &kindError{
+			kind: C.GoString(err_kind),
+			err:  fmt.Errorf("failed applying nmstate net state %s with rc: %d, err_msg: %s, err_kind: %s", redactState(state), rc, hideSecrets(C.GoString(err_msg), secrets), C.GoString(err_kind)),
+		}
+	}
+	if flags&noCommit != 0 {
+		n.trackCheckpoint(C.GoString(log))
 	}
-	if err := n.writeLog(log); err != nil {
+	if err := n.writeLog(C.GoString(log), secrets...); err != nil {
 		return "", fmt.Errorf("failed when applying state: %v", err)
 	}
+	if len(secrets) > 0 && flags&includeSecrets == 0 {
+		state = redactState(state)
+	}
+	return n.indentJSON(state), nil
+}
+
+// prepareApply returns the state as sent to libnmstate by applyNetState once
+// the options altering it are applied, or an error if it is invalid or
+// references interfaces not allowed by WithManagedInterfaces. Every apply
+// goes through it.
+func (n *Nmstate) prepareApply(state string) (string, error) {
+	if err := n.checkManagedInterfaces(state); err != nil {
+		return "", err
+	}
+	if err := validateMACsec(state); err != nil {
+		return "", err
+	}
+	if n.stripReadOnly {
+		stripped, err := StripReadOnly(state)
+		if err != nil {
+			return "", fmt.Errorf("failed stripping read-only properties: %v", err)
+		}
+		state = stripped
+	}
+	if n.ignoreMissingAbsent {
+		current, err := n.RetrieveNetState()
+		if err != nil {
+			return "", err
+		}
+		desired, err := dropMissingAbsent(state, current)
+		if err != nil {
+			return "", fmt.Errorf("failed removing missing absent interfaces: %v", err)
+		}
+		state = desired
+	}
 	return state, nil
 }
 
@@ -150,19 +502,27 @@ func (n *Nmstate) CommitCheckpoint(checkpoint string) (string, error) {
 		err_kind     *C.char
 		err_msg      *C.char
 	)
-	c_checkpoint = C.CString(checkpoint)
+	if n.optionErr != nil {
+		return "", n.optionErr
+	}
+	if err := n.recordCall(commitOp, 0, checkpoint); err != nil {
+		return "", err
+	}
+	c_checkpoint = newCString(checkpoint)
 	rc := C.nmstate_checkpoint_commit(c_checkpoint, &log, &err_kind, &err_msg)
+	trackCStrings(log, err_kind, err_msg)
 
 	defer func() {
-		C.nmstate_cstring_free(c_checkpoint)
-		C.nmstate_cstring_free(err_msg)
-		C.nmstate_cstring_free(err_kind)
-		C.nmstate_cstring_free(log)
+		freeCString(c_checkpoint)
+		freeCString(err_msg)
+		freeCString(err_kind)
+		freeCString(log)
 	}()
 	if rc != 0 {
 		return "", fmt.Errorf("failed commiting checkpoint %s with rc: %d, err_msg: %s, err_kind: %s", checkpoint, rc, C.GoString(err_msg), C.GoString(err_kind))
 	}
-	if err := n.writeLog(log); err != nil {
+	n.releaseCheckpoint(checkpoint)
+	if err := n.writeLog(C.GoString(log)); err != nil {
 		return "", fmt.Errorf("failed when commiting: %v", err)
 	}
 	return checkpoint, nil
@@ -177,35 +537,135 @@ func (n *Nmstate) RollbackCheckpoint(checkpoint string) (string, error) {
 		err_kind     *C.char
 		err_msg      *C.char
 	)
-	c_checkpoint = C.CString(checkpoint)
+	if n.optionErr != nil {
+		return "", n.optionErr
+	}
+	if err := n.recordCall(rollbackOp, 0, checkpoint); err != nil {
+		return "", err
+	}
+	c_checkpoint = newCString(checkpoint)
 	rc := C.nmstate_checkpoint_rollback(c_checkpoint, &log, &err_kind, &err_msg)
+	trackCStrings(log, err_kind, err_msg)
 
 	defer func() {
-		C.nmstate_cstring_free(c_checkpoint)
-		C.nmstate_cstring_free(err_msg)
-		C.nmstate_cstring_free(err_kind)
-		C.nmstate_cstring_free(log)
+		freeCString(c_checkpoint)
+		freeCString(err_msg)
+		freeCString(err_kind)
+		freeCString(log)
 	}()
 	if rc != 0 {
 		return "", fmt.Errorf("failed when doing rollback checkpoint %s with rc: %d, err_msg: %s, err_kind: %s", checkpoint, rc, C.GoString(err_msg), C.GoString(err_kind))
 	}
-	if err := n.writeLog(log); err != nil {
+	n.releaseCheckpoint(checkpoint)
+	if err := n.writeLog(C.GoString(log)); err != nil {
 		return "", fmt.Errorf("failed when doing rollback: %v", err)
 	}
 	return checkpoint, nil
 }
 
-func (n *Nmstate) writeLog(log *C.char) error {
+// indentJSON indents the state if WithJSONIndent is set. A state which is not
+// json, like a yaml desired state, is returned untouched.
+func (n *Nmstate) indentJSON(state string) string {
+	if n.jsonIndent == "" {
+		return state
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(state), "", n.jsonIndent); err != nil {
+		return state
+	}
+	return indented.String()
+}
+
+// newCString allocates a C string counted by the leak check instrumentation,
+// it must be released with freeCString.
+func newCString(s string) *C.char {
+	leakCheckAlloc()
+	return C.CString(s)
+}
+
+// trackCStrings counts the C strings allocated by libnmstate.
+func trackCStrings(cstrings ...*C.char) {
+	for _, cstring := range cstrings {
+		if cstring != nil {
+			leakCheckAlloc()
+		}
+	}
+}
+
+func freeCString(cstring *C.char) {
+	if cstring != nil {
+		leakCheckFree()
+	}
+	C.nmstate_cstring_free(cstring)
+}
+
+func (n *Nmstate) recordCall(op string, flags byte, input string) error {
+	if n.onCall != nil {
+		n.onCall(op, uint32(flags))
+	}
+	if n.callRecorder == nil {
+		return nil
+	}
+	record, err := json.Marshal(n.newCallRecord(op, flags, input))
+	if err != nil {
+		return fmt.Errorf("failed encoding %s call record: %v", op, err)
+	}
+	if _, err := n.callRecorder.Write(append(record, '\n')); err != nil {
+		return fmt.Errorf("failed recording %s call: %v", op, err)
+	}
+	return nil
+}
+
+// WithLogWriterOverride returns a copy of the client writing its logs to w
+// instead of the writer set by WithLogsWritter(), for instance to collect the
+// logs of a single request. The copy shares the outstanding checkpoint with
+// the client, so a checkpoint created through one of them is committed or
+// rolled back through the other, the client itself is left untouched.
+func (n *Nmstate) WithLogWriterOverride(w io.Writer) *Nmstate {
+	override := *n
+	override.logsWriter = w
+	return &override
+}
+
+// writeLog writes the libnmstate log to the logs writer with the secrets
+// provided hidden.
+func (n *Nmstate) writeLog(log string, secrets ...string) error {
 	if n.logsWriter == nil {
 		return nil
 	}
-	_, err := io.WriteString(n.logsWriter, C.GoString(log))
+	_, err := io.WriteString(n.logsWriter, n.prefixLog(hideSecrets(log, secrets)))
 	if err != nil {
 		return fmt.Errorf("failed writting logs: %v", err)
 	}
 	return nil
 }
 
+// prefixLog adds the request ID and trace context to each log line. The
+// request ID is quoted so newlines or other control characters in it cannot
+// forge log lines.
+func (n *Nmstate) prefixLog(logs string) string {
+	fields := []string{}
+	if n.requestID != "" {
+		fields = append(fields, "request-id="+strconv.Quote(n.requestID))
+	}
+	if n.traceID != "" {
+		fields = append(fields, "trace-id="+n.traceID, "span-id="+n.spanID)
+	}
+	if len(fields) == 0 {
+		return logs
+	}
+	prefix := "[" + strings.Join(fields, " ") + "] "
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(logs, "\n") {
+		if line == "" {
+			continue
+		}
+		b.WriteString(prefix)
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
 // GenerateConfiguration generates the configuration for the state provided.
 // This function returns the configuration files for the state provided.
 func (n *Nmstate) GenerateConfiguration(state string) (string, error) {
@@ -216,20 +676,27 @@ func (n *Nmstate) GenerateConfiguration(state string) (string, error) {
 		err_kind *C.char
 		err_msg  *C.char
 	)
-	c_state = C.CString(state)
+	if n.optionErr != nil {
+		return "", n.optionErr
+	}
+	if err := n.recordCall(genconfOp, 0, state); err != nil {
+		return "", err
+	}
+	c_state = newCString(state)
 	rc := C.nmstate_generate_configurations(c_state, &config, &log, &err_kind, &err_msg)
+	trackCStrings(config, log, err_kind, err_msg)
 
 	defer func() {
-		C.nmstate_cstring_free(c_state)
-		C.nmstate_cstring_free(config)
-		C.nmstate_cstring_free(err_msg)
-		C.nmstate_cstring_free(err_kind)
-		C.nmstate_cstring_free(log)
+		freeCString(c_state)
+		freeCString(config)
+		freeCString(err_msg)
+		freeCString(err_kind)
+		freeCString(log)
 	}()
 	if rc != 0 {
-		return "", fmt.Errorf("failed when generating the configuration %s with rc: %d, err_msg: %s, err_kind: %s", state, rc, C.GoString(err_msg), C.GoString(err_kind))
+		return "", fmt.Errorf("failed when generating the configuration %s with rc: %d, err_msg: %s, err_kind: %s", redactState(state), rc, hideSecrets(C.GoString(err_msg), secretValues(state)), C.GoString(err_kind))
 	}
-	if err := n.writeLog(log); err != nil {
+	if err := n.writeLog(C.GoString(log), secretValues(state)...); err != nil {
 		return "", fmt.Errorf("failed when generating the configuration: %v", err)
 	}
 	return C.GoString(config), nil
@@ -1,8 +1,12 @@
 package nmstate
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -72,3 +76,166 @@ func TestGenerateConfiguration(t *testing.T) {
 	assert.NoError(t, err, "must succeed calling nmstate_generate_configurations c binding")
 	assert.NotEmpty(t, config, "config should not be empty")
 }
+
+func TestPrefixLogWithRequestID(t *testing.T) {
+	nms := New(WithRequestID("req\n42"))
+	logs := nms.prefixLog("first line\nsecond line\n")
+	assert.Equal(t, "[request-id=\"req\\n42\"] first line\n[request-id=\"req\\n42\"] second line\n", logs, "every log line must carry the escaped request ID")
+
+	nms = New()
+	assert.Equal(t, "first line\n", nms.prefixLog("first line\n"), "logs must be untouched without a request ID")
+}
+
+func TestWithLogWriterOverride(t *testing.T) {
+	var defaultLogs, overrideLogs bytes.Buffer
+	nms := New(WithLogsWritter(&defaultLogs), WithKernelOnly())
+	_, err := nms.WithLogWriterOverride(&overrideLogs).RetrieveNetState()
+	assert.NoError(t, err, "must succeed calling retrieve_net_state c binding")
+	assert.NotEmpty(t, overrideLogs.String(), "override writer must receive the logs")
+	assert.Empty(t, defaultLogs.String(), "default writer must not receive the overridden logs")
+
+	_, err = nms.RetrieveNetState()
+	assert.NoError(t, err, "must succeed calling retrieve_net_state c binding")
+	assert.NotEmpty(t, defaultLogs.String(), "default writer must still be used by the client")
+}
+
+func TestWithLogWriterOverrideCopy(t *testing.T) {
+	var defaultLogs, overrideLogs bytes.Buffer
+	nms := New(WithLogsWritter(&defaultLogs), WithNoCommit())
+	override := nms.WithLogWriterOverride(&overrideLogs)
+	assert.Equal(t, &overrideLogs, override.logsWriter, "override writer must be used by the copy")
+	assert.Equal(t, &defaultLogs, nms.logsWriter, "client writer must be untouched")
+	assert.Equal(t, nms.flags, override.flags, "copy must keep the client options")
+
+	override.trackCheckpoint(`[{"time":"1","level":"INFO","file":"nmstate::query_apply::net_state","msg":"Created checkpoint /org/freedesktop/NetworkManager/Checkpoint/7"}]`)
+	assert.True(t, errors.Is(nms.checkOutstandingCheckpoint(), ErrCheckpointExists), "client must see the checkpoint created by the copy")
+	nms.releaseCheckpoint("/org/freedesktop/NetworkManager/Checkpoint/7")
+	assert.NoError(t, override.checkOutstandingCheckpoint(), "copy must see the checkpoint released by the client")
+}
+
+func TestRetrieveWithEthtool(t *testing.T) {
+	nms := New()
+	netState, err := nms.RetrieveWithEthtool()
+	assert.NoError(t, err, "must succeed calling retrieve_net_state c binding")
+	assert.NotEmpty(t, netState, "net state should not be empty")
+}
+
+func TestRetrieveByType(t *testing.T) {
+	nms := New()
+	_, err := nms.ApplyNetState(`{
+"interfaces": [{
+  "name": "dummy1",
+  "state": "up",
+  "type": "dummy"
+}]}
+`)
+	assert.NoError(t, err, "must succeed calling nmstate_net_state_apply c binding")
+
+	netState, err := nms.RetrieveByType("dummy")
+	assert.NoError(t, err, "must succeed retrieving dummy interfaces")
+	assert.Contains(t, netState, `"dummy1"`, "net state should contain the dummy interface")
+	assert.NotContains(t, netState, `"loopback"`, "net state should only contain dummy interfaces")
+
+	netState, err = nms.RetrieveByType("infiniband")
+	assert.NoError(t, err, "must succeed retrieving absent interface type")
+	assert.JSONEq(t, `{"interfaces": []}`, netState, "net state should have no interfaces")
+}
+
+func TestApplyNetStateStripReadOnly(t *testing.T) {
+	nms := New(WithStripReadOnlyOnApply())
+	netState, err := nms.ApplyNetState(`{
+"interfaces": [{
+  "name": "dummy1",
+  "state": "up",
+  "type": "dummy",
+  "min-mtu": 0,
+  "max-mtu": 65535
+}]}
+`)
+	assert.NoError(t, err, "must succeed calling nmstate_net_state_apply c binding")
+	assert.NotContains(t, netState, "min-mtu", "applied state should not contain read-only properties")
+}
+
+func TestRecordedCallFlags(t *testing.T) {
+	type call struct {
+		op    string
+		flags uint32
+	}
+	calls := []call{}
+	nms := New(WithIncludeSecrets())
+	nms.onCall = func(op string, flags uint32) {
+		calls = append(calls, call{op, flags})
+	}
+	nms.RetrieveNetState()
+	nms.ApplyNoVerifyThenCheck(`{"interfaces": [{"name": "dummy3", "state": "up", "type": "dummy"}]}`, func(string) error {
+		return fmt.Errorf("rejected by test")
+	})
+	assert.Equal(t, call{retrieveOp, includeSecrets}, calls[0], "retrieve must only send the client flags")
+	assert.Equal(t, call{applyOp, includeSecrets | noVerify | noCommit}, calls[1], "apply must add the no verify and no commit flags")
+}
+
+func TestRunWithTimeout(t *testing.T) {
+	result := runWithTimeout(time.Second, func() retrieveResult {
+		return retrieveResult{state: "{}", log: "retrieved"}
+	})
+	assert.NoError(t, result.err, "must succeed when the call returns in time")
+	assert.Equal(t, retrieveResult{state: "{}", log: "retrieved"}, result)
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	result = runWithTimeout(10*time.Millisecond, func() retrieveResult {
+		<-unblock
+		return retrieveResult{state: "{}"}
+	})
+	assert.True(t, errors.Is(result.err, ErrRetrieveTimeout), "must time out when the call blocks")
+	assert.Empty(t, result.log, "logs of a timed out call must be dropped")
+}
+
+func TestIndentJSON(t *testing.T) {
+	nms := New(WithJSONIndent("  "))
+	assert.Equal(t, "{\n  \"interfaces\": []\n}", nms.indentJSON(`{"interfaces":[]}`), "json state must be indented")
+	assert.Equal(t, "interfaces: []\n", nms.indentJSON("interfaces: []\n"), "yaml state must be untouched")
+	assert.Equal(t, `{"interfaces":[]}`, New().indentJSON(`{"interfaces":[]}`), "state must be untouched without indent")
+}
+
+func TestJSONIndentRetrieveAndApply(t *testing.T) {
+	nms := New(WithJSONIndent("  "))
+	netState, err := nms.RetrieveNetState()
+	assert.NoError(t, err, "must succeed calling retrieve_net_state c binding")
+	assert.Contains(t, netState, "\n  \"", "retrieved state should be indented")
+
+	netState, err = nms.ApplyNetState(`{"interfaces": [{"name": "dummy1", "state": "up", "type": "dummy"}]}`)
+	assert.NoError(t, err, "must succeed calling nmstate_net_state_apply c binding")
+	assert.Contains(t, netState, "\n  \"", "applied state should be indented")
+}
+
+func TestPrefixLogWithTraceContext(t *testing.T) {
+	nms := New(WithRequestID("req42"), WithTraceContext("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"))
+	assert.NoError(t, nms.optionErr, "valid trace context must be accepted")
+	assert.Equal(t, "[request-id=\"req42\" trace-id=4bf92f3577b34da6a3ce929d0e0e4736 span-id=00f067aa0ba902b7] line\n", nms.prefixLog("line\n"), "log line must carry the trace context")
+}
+
+func TestWithTraceContextInvalid(t *testing.T) {
+	for _, ids := range [][2]string{
+		{"4bf92f3577b34da6a3ce929d0e0e473", "00f067aa0ba902b7"},
+		{"4BF92F3577B34DA6A3CE929D0E0E4736", "00f067aa0ba902b7"},
+		{"00000000000000000000000000000000", "00f067aa0ba902b7"},
+		{"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902bz"},
+	} {
+		nms := New(WithTraceContext(ids[0], ids[1]))
+		_, err := nms.RetrieveNetState()
+		assert.EqualError(t, err, fmt.Sprintf("invalid trace context, trace ID %q, span ID %q", ids[0], ids[1]), "invalid trace context must be reported")
+	}
+}
+
+func TestApplyNetStateIgnoreMissingAbsent(t *testing.T) {
+	state := `{"interfaces": [{"name": "nonexistent0", "state": "absent"}]}`
+	nms := New(WithIgnoreMissingAbsent())
+	netState, err := nms.ApplyNetState(state)
+	assert.NoError(t, err, "must succeed applying absent nonexistent interface")
+	assert.JSONEq(t, `{"interfaces": []}`, netState, "nonexistent absent interface must be removed")
+
+	netState, err = New().ApplyNetState(state)
+	assert.NoError(t, err, "libnmstate must ignore the absent nonexistent interface without the option")
+	assert.Equal(t, state, netState, "state must be applied as is without the option")
+}
@@ -0,0 +1,116 @@
+package nmstate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// CallRecord is a libnmstate call written by WithCallRecorder.
+type CallRecord struct {
+	Op      string `json:"op"`
+	Flags   uint32 `json:"flags"`
+	Timeout uint   `json:"timeout"`
+	// Input is the state, with its secrets redacted, or the checkpoint path
+	// provided to the call.
+	Input string `json:"input,omitempty"`
+}
+
+// ParseCallRecording reads the json lines written by WithCallRecorder.
+func ParseCallRecording(r io.Reader) ([]CallRecord, error) {
+	calls := []CallRecord{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		call := CallRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &call); err != nil {
+			return nil, fmt.Errorf("failed parsing call record at line %d: %v", line, err)
+		}
+		calls = append(calls, call)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading call recording: %v", err)
+	}
+	return calls, nil
+}
+
+// ReplayCalls passes the recorded calls in order to issue, stopping at the
+// first failure. issue is typically a fake libnmstate reproducing the
+// reported behavior, the calls are never sent to the local libnmstate so
+// replaying a bug report recording does not change the host network.
+func ReplayCalls(calls []CallRecord, issue func(call CallRecord) error) error {
+	for i, call := range calls {
+		if err := issue(call); err != nil {
+			return fmt.Errorf("failed replaying call %d (%s): %v", i+1, call.Op, err)
+		}
+	}
+	return nil
+}
+
+// EquivalentApplies reports whether clients a and b would issue the same
+// libnmstate calls, compared like the records of WithCallRecorder, when
+// ApplyNetState succeeds for the network state in json format provided: the
+// apply, the commit of WithRollbackIfUnreachable() unless WithNoCommit() is
+// set, or no call at all when a result is remembered for the
+// WithIdempotencyKey() key. Nothing is applied, only WithIgnoreMissingAbsent()
+// retrieves the current state, without recording the call nor calling the
+// hooks of the clients.
+func EquivalentApplies(a, b *Nmstate, state string) (bool, error) {
+	callsA, err := a.plannedCalls(state)
+	if err != nil {
+		return false, fmt.Errorf("failed planning apply of first client: %v", err)
+	}
+	callsB, err := b.plannedCalls(state)
+	if err != nil {
+		return false, fmt.Errorf("failed planning apply of second client: %v", err)
+	}
+	return reflect.DeepEqual(callsA, callsB), nil
+}
+
+// plannedCalls returns the records of the calls a successful ApplyNetState
+// would issue.
+func (n *Nmstate) plannedCalls(state string) ([]CallRecord, error) {
+	if n.optionErr != nil {
+		return nil, n.optionErr
+	}
+	if n.idempotencyKey != "" {
+		idempotencyCache.Lock()
+		result, ok := cachedIdempotentResult(n.idempotencyKey)
+		idempotencyCache.Unlock()
+		if ok {
+			if result.fingerprint != n.idempotencyFingerprint(state) {
+				return nil, idempotencyConflict(n.idempotencyKey)
+			}
+			return []CallRecord{}, nil
+		}
+	}
+	planner := *n
+	planner.callRecorder = nil
+	planner.onCall = nil
+	state, err := planner.prepareApply(state)
+	if err != nil {
+		return nil, err
+	}
+	if n.rollbackTarget == "" {
+		return []CallRecord{n.newCallRecord(applyOp, n.flags, state)}, nil
+	}
+	calls := []CallRecord{n.newCallRecord(applyOp, n.flags|noCommit, state)}
+	if n.flags&noCommit == 0 {
+		calls = append(calls, n.newCallRecord(commitOp, 0, ""))
+	}
+	return calls, nil
+}
+
+func (n *Nmstate) newCallRecord(op string, flags byte, input string) CallRecord {
+	return CallRecord{
+		Op:      op,
+		Flags:   uint32(flags),
+		Timeout: n.timeout,
+		Input:   redactInput(op, input),
+	}
+}
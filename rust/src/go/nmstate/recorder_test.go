@@ -0,0 +1,108 @@
+package nmstate
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordedCallReplay(t *testing.T) {
+	var recording bytes.Buffer
+	nms := New(WithCallRecorder(&recording), WithTimeout(30*time.Second), WithNoCommit())
+	err := nms.recordCall(applyOp, nms.flags, `{"interfaces": [{
+"name": "eth1", "type": "ethernet", "state": "up",
+"802.1x": {"identity": "client", "private-key-password": "secret"}
+}]}`)
+	assert.NoError(t, err, "must succeed recording the apply call")
+	assert.NotContains(t, recording.String(), "secret", "secrets must be redacted from the recording")
+
+	calls, err := ParseCallRecording(&recording)
+	assert.NoError(t, err, "must succeed parsing the recording")
+	assert.Equal(t, []CallRecord{{
+		Op:      applyOp,
+		Flags:   noCommit,
+		Timeout: 30,
+		Input:   `{"interfaces":[{"802.1x":{"identity":"client","private-key-password":"<_password_hid_by_nmstate>"},"name":"eth1","state":"up","type":"ethernet"}]}`,
+	}}, calls)
+
+	replayed := []CallRecord{}
+	err = ReplayCalls(calls, func(call CallRecord) error {
+		replayed = append(replayed, call)
+		return nil
+	})
+	assert.NoError(t, err, "must succeed replaying the recording")
+	assert.Equal(t, calls, replayed)
+}
+
+func TestEquivalentAppliesRecordsNothing(t *testing.T) {
+	var recording bytes.Buffer
+	calls := 0
+	nms := New(WithIgnoreMissingAbsent(), WithCallRecorder(&recording))
+	nms.onCall = func(string, uint32) {
+		calls++
+	}
+	_, err := EquivalentApplies(nms, nms, `{"interfaces": [{"name": "dummy1", "state": "absent"}]}`)
+	assert.NoError(t, err, "must succeed comparing applies")
+	assert.Empty(t, recording.String(), "planning must not record the retrieve call")
+	assert.Zero(t, calls, "planning must not call the hooks")
+}
+
+func TestParseCallRecordingInvalid(t *testing.T) {
+	_, err := ParseCallRecording(strings.NewReader(`{"op": "retrieve", "flags": 0, "timeout": 0}` + "\nnot json\n"))
+	assert.EqualError(t, err, "failed parsing call record at line 2: invalid character 'o' in literal null (expecting 'u')")
+
+	err = ReplayCalls([]CallRecord{{Op: retrieveOp}, {Op: applyOp}, {Op: commitOp}}, func(call CallRecord) error {
+		if call.Op == applyOp {
+			return errors.New("apply failed")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "failed replaying call 2 (apply): apply failed")
+}
+
+func TestEquivalentApplies(t *testing.T) {
+	state := `{"interfaces": [{"name": "dummy1", "type": "dummy", "state": "up", "mtu": 1500}]}`
+	configured, err := NewFromConfig(`{"timeout": 30, "flags": ["no-commit"]}`)
+	assert.NoError(t, err, "must succeed creating client from config")
+
+	equivalent, err := EquivalentApplies(New(WithTimeout(30*time.Second), WithNoCommit()), configured, state)
+	assert.NoError(t, err, "must succeed comparing applies")
+	assert.True(t, equivalent, "clients with the same timeout and flags must be equivalent")
+
+	equivalent, err = EquivalentApplies(
+		New(WithTimeout(30*time.Second), WithRollbackIfUnreachable("192.0.2.1:22", 10*time.Second), WithNoCommit(), WithStripReadOnlyOnApply()),
+		configured, state)
+	assert.NoError(t, err, "must succeed comparing applies")
+	assert.True(t, equivalent, "rollback if unreachable without commit must only apply and stripping nothing must not alter the state")
+
+	equivalent, err = EquivalentApplies(
+		New(WithTimeout(30*time.Second), WithRollbackIfUnreachable("192.0.2.1:22", 10*time.Second)),
+		configured, state)
+	assert.NoError(t, err, "must succeed comparing applies")
+	assert.False(t, equivalent, "rollback if unreachable commits once the target answers")
+
+	equivalent, err = EquivalentApplies(New(WithTimeout(30*time.Second), WithNoCommit(), WithKernelOnly()), configured, state)
+	assert.NoError(t, err, "must succeed comparing applies")
+	assert.False(t, equivalent, "clients with different flags must not be equivalent")
+
+	keyed := New(WithTimeout(30*time.Second), WithNoCommit(), WithIdempotencyKey("equivalent-applies"))
+	_, err = keyed.applyIdempotent("equivalent-applies", state, func(state string) (string, error) {
+		return state, nil
+	})
+	assert.NoError(t, err, "must succeed remembering the result")
+	defer func() {
+		idempotencyCache.Lock()
+		delete(idempotencyCache.results, "equivalent-applies")
+		idempotencyCache.Unlock()
+	}()
+	equivalent, err = EquivalentApplies(keyed, configured, state)
+	assert.NoError(t, err, "must succeed comparing applies")
+	assert.False(t, equivalent, "a remembered result must not issue any call")
+
+	_, err = EquivalentApplies(New(WithManagedInterfaces("dummy2")), configured, state)
+	assert.EqualError(t, err, "failed planning apply of first client: net state references interfaces not managed by this client: dummy1")
+}
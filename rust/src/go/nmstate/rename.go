@@ -0,0 +1,69 @@
+package nmstate
+
+import "strings"
+
+// RenamedInterfaces retrieves the current network state and compares it with
+// the desired network state in json format to find the NetworkManager
+// profiles the apply would rename. nmstate never renames kernel interfaces:
+// only a desired interface with "identifier": "mac-address" gives a new
+// profile name, its name, to the current interface with that MAC address.
+// The new profile name is returned indexed by the current profile name, which
+// is the profile-name reported by the current state or, when there is none,
+// the interface name NetworkManager names the profile after. The matching is
+// a heuristic with limitations:
+//
+//   - Desired interfaces identified by name, the default, are never reported:
+//     their mac-address changes the MAC address of the interface named.
+//   - Desired interfaces without mac-address, or marked absent, are never
+//     reported.
+//   - A MAC address shared by several current interfaces of the same type,
+//     like VLANs over one base interface, is ambiguous and skipped.
+func (n *Nmstate) RenamedInterfaces(desired string) (map[string]string, error) {
+	current, err := n.RetrieveNetState()
+	if err != nil {
+		return nil, err
+	}
+	return renamedInterfaces(current, desired)
+}
+
+func renamedInterfaces(current, desired string) (map[string]string, error) {
+	currentState, err := decodeState(current)
+	if err != nil {
+		return nil, err
+	}
+	desiredState, err := decodeState(desired)
+	if err != nil {
+		return nil, err
+	}
+	type identity struct {
+		ifType string
+		mac    string
+	}
+	byMAC := map[identity][]map[string]interface{}{}
+	for _, iface := range stateInterfaces(currentState) {
+		if mac := stringField(iface, "mac-address"); mac != "" {
+			id := identity{stringField(iface, "type"), strings.ToUpper(mac)}
+			byMAC[id] = append(byMAC[id], iface)
+		}
+	}
+
+	renamed := map[string]string{}
+	for _, iface := range stateInterfaces(desiredState) {
+		mac := stringField(iface, "mac-address")
+		if mac == "" || stringField(iface, "identifier") != "mac-address" || stringField(iface, "state") == "absent" {
+			continue
+		}
+		matches := byMAC[identity{stringField(iface, "type"), strings.ToUpper(mac)}]
+		if len(matches) != 1 {
+			continue
+		}
+		profile := stringField(matches[0], "profile-name")
+		if profile == "" {
+			profile = stringField(matches[0], "name")
+		}
+		if name := stringField(iface, "name"); profile != name {
+			renamed[profile] = name
+		}
+	}
+	return renamed, nil
+}
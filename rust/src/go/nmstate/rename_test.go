@@ -0,0 +1,37 @@
+package nmstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const renameCurrentState = `{"interfaces": [
+  {"name": "eth1", "type": "ethernet", "state": "up", "mac-address": "52:54:00:AA:BB:01"},
+  {"name": "eth2", "type": "ethernet", "state": "up", "mac-address": "52:54:00:AA:BB:02"},
+  {"name": "eth2.10", "type": "vlan", "state": "up", "mac-address": "52:54:00:AA:BB:02"},
+  {"name": "eth2.20", "type": "vlan", "state": "up", "mac-address": "52:54:00:AA:BB:02"},
+  {"name": "eth3", "type": "ethernet", "state": "up", "mac-address": "52:54:00:AA:BB:03", "profile-name": "uplink"}
+]}`
+
+func TestRenamedInterfaces(t *testing.T) {
+	renamed, err := renamedInterfaces(renameCurrentState, `{"interfaces": [
+  {"name": "lan0", "type": "ethernet", "state": "up", "identifier": "mac-address", "mac-address": "52:54:00:aa:bb:01"},
+  {"name": "wan", "type": "ethernet", "state": "up", "identifier": "mac-address", "mac-address": "52:54:00:AA:BB:03"}
+]}`)
+	assert.NoError(t, err, "must succeed detecting renames")
+	assert.Equal(t, map[string]string{"eth1": "lan0", "uplink": "wan"}, renamed, "renames must be keyed by current profile name")
+}
+
+func TestRenamedInterfacesNoRename(t *testing.T) {
+	renamed, err := renamedInterfaces(renameCurrentState, `{"interfaces": [
+  {"name": "lan0", "type": "ethernet", "state": "up", "mac-address": "52:54:00:AA:BB:01"},
+  {"name": "eth2", "type": "ethernet", "state": "up", "mac-address": "52:54:00:AA:BB:01"},
+  {"name": "vlan10", "type": "vlan", "state": "up", "identifier": "mac-address", "mac-address": "52:54:00:AA:BB:02"},
+  {"name": "uplink", "type": "ethernet", "state": "up", "identifier": "mac-address", "mac-address": "52:54:00:AA:BB:03"},
+  {"name": "old1", "type": "ethernet", "state": "absent", "identifier": "mac-address", "mac-address": "52:54:00:AA:BB:01"},
+  {"name": "eth4", "type": "ethernet", "state": "up", "identifier": "mac-address"}
+]}`)
+	assert.NoError(t, err, "must succeed detecting renames")
+	assert.Empty(t, renamed, "name identified MAC changes, unchanged profile names, ambiguous MACs and absent interfaces must not be reported")
+}
@@ -0,0 +1,47 @@
+package nmstate
+
+import (
+	"fmt"
+	"time"
+)
+
+const journalTimeFormat = "2006-01-02 15:04:05 UTC"
+
+// Result describes an apply operation. It is also returned when the apply
+// failed so its time window can be used to look for NetworkManager logs.
+type Result struct {
+	// State is the applied network state, empty when the apply failed.
+	State      string
+	RequestID  string
+	TraceID    string
+	SpanID     string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// ApplyNetStateWithResult applies the network state in json format like
+// ApplyNetState and returns the details of the operation.
+func (n *Nmstate) ApplyNetStateWithResult(state string) (Result, error) {
+	result := Result{
+		RequestID: n.requestID,
+		TraceID:   n.traceID,
+		SpanID:    n.spanID,
+		StartedAt: time.Now(),
+	}
+	applied, err := n.ApplyNetState(state)
+	result.FinishedAt = time.Now()
+	result.State = applied
+	return result, err
+}
+
+// JournalHint returns a journalctl command showing the NetworkManager logs
+// of the operation time window. journalctl only takes whole seconds so the
+// window is widened to the enclosing seconds.
+func (r Result) JournalHint() string {
+	since := r.StartedAt.UTC().Truncate(time.Second)
+	until := r.FinishedAt.UTC().Truncate(time.Second)
+	if until.Before(r.FinishedAt) {
+		until = until.Add(time.Second)
+	}
+	return fmt.Sprintf("journalctl -u NetworkManager --since %q --until %q", since.Format(journalTimeFormat), until.Format(journalTimeFormat))
+}
@@ -0,0 +1,27 @@
+package nmstate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalHint(t *testing.T) {
+	result := Result{
+		StartedAt:  time.Date(2023, 8, 25, 10, 15, 30, 250000000, time.UTC),
+		FinishedAt: time.Date(2023, 8, 25, 12, 15, 32, 100000000, time.FixedZone("CEST", 2*60*60)),
+	}
+	assert.Equal(t, `journalctl -u NetworkManager --since "2023-08-25 10:15:30 UTC" --until "2023-08-25 10:15:33 UTC"`, result.JournalHint())
+}
+
+func TestApplyNetStateWithResult(t *testing.T) {
+	nms := New(WithRequestID("req42"), WithTraceContext("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"))
+	result, err := nms.ApplyNetStateWithResult(`{"interfaces": [{"name": "dummy1", "state": "up", "type": "dummy"}]}`)
+	assert.NoError(t, err, "must succeed calling nmstate_net_state_apply c binding")
+	assert.Equal(t, "req42", result.RequestID)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", result.TraceID, "trace ID must propagate into the result")
+	assert.Equal(t, "00f067aa0ba902b7", result.SpanID, "span ID must propagate into the result")
+	assert.NotEmpty(t, result.State, "applied state should not be empty")
+	assert.False(t, result.FinishedAt.Before(result.StartedAt), "apply must finish after it started")
+}
@@ -0,0 +1,328 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const mainRouteTable = 254
+
+// stateRoutes returns the running routes of a decoded network state, or the
+// configured ones for a desired state without running routes.
+func stateRoutes(netState map[string]interface{}) []map[string]interface{} {
+	routes, _ := netState["routes"].(map[string]interface{})
+	list, ok := routes["running"].([]interface{})
+	if !ok {
+		list, _ = routes["config"].([]interface{})
+	}
+	entries := make([]map[string]interface{}, 0, len(list))
+	for _, entry := range list {
+		if route, ok := entry.(map[string]interface{}); ok {
+			entries = append(entries, route)
+		}
+	}
+	return entries
+}
+
+// numberField returns the integer value of a json number field, def when
+// missing or invalid.
+func numberField(object map[string]interface{}, key string, def int64) int64 {
+	number, ok := object[key].(json.Number)
+	if !ok {
+		return def
+	}
+	value, err := strconv.ParseInt(number.String(), 10, 64)
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// DefaultRouteInterfaces returns the next-hop-interface of the IPv4 and IPv6
+// default routes of the main route table in the network state in json
+// format. The running routes are used when present, the configured ones
+// otherwise. With several default routes the one with the lowest metric
+// wins. An empty name is returned for a family without default route.
+func DefaultRouteInterfaces(state string) (v4iface string, v6iface string, err error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return "", "", err
+	}
+	best := map[string]int64{}
+	found := map[string]string{}
+	for _, route := range stateRoutes(netState) {
+		destination := stringField(route, "destination")
+		if defaultRouteFamily(route) == "" || stringField(route, "state") == "absent" {
+			continue
+		}
+		metric := numberField(route, "metric", 0)
+		if current, ok := best[destination]; ok && current <= metric {
+			continue
+		}
+		best[destination] = metric
+		found[destination] = stringField(route, "next-hop-interface")
+	}
+	return found["0.0.0.0/0"], found["::/0"], nil
+}
+
+type defaultRoute struct {
+	family string
+	iface  string
+}
+
+// WouldIsolateHost reports whether applying the desired network state in
+// json format would leave the host without any up interface carrying a
+// default route, compared with the current network state. reasons lists the
+// default routes which would be lost. A host without default route is never
+// considered isolated.
+func (n *Nmstate) WouldIsolateHost(desired string) (bool, []string, error) {
+	current, err := n.RetrieveNetState()
+	if err != nil {
+		return false, nil, err
+	}
+	return wouldIsolateHost(current, desired)
+}
+
+func wouldIsolateHost(current, desired string) (bool, []string, error) {
+	currentState, err := decodeState(current)
+	if err != nil {
+		return false, nil, err
+	}
+	desiredState, err := decodeState(desired)
+	if err != nil {
+		return false, nil, err
+	}
+	up := map[string]bool{}
+	for _, iface := range stateInterfaces(currentState) {
+		up[stringField(iface, "name")] = stringField(iface, "state") == "up"
+	}
+	disabled := map[defaultRoute]bool{}
+	for _, iface := range stateInterfaces(desiredState) {
+		name := stringField(iface, "name")
+		switch stringField(iface, "state") {
+		case "absent", "down":
+			up[name] = false
+		case "up":
+			up[name] = true
+		}
+		for _, family := range []string{"ipv4", "ipv6"} {
+			ipConfig, _ := iface[family].(map[string]interface{})
+			if enabled, ok := ipConfig["enabled"].(bool); ok && !enabled {
+				disabled[defaultRoute{family, name}] = true
+			}
+		}
+	}
+
+	routes := []defaultRoute{}
+	for _, route := range stateRoutes(currentState) {
+		if defaultRouteFamily(route) != "" {
+			routes = append(routes, defaultRoute{defaultRouteFamily(route), stringField(route, "next-hop-interface")})
+		}
+	}
+	if len(routes) == 0 {
+		return false, nil, nil
+	}
+	desiredRoutes, _ := desiredState["routes"].(map[string]interface{})
+	config, _ := desiredRoutes["config"].([]interface{})
+	for _, entry := range config {
+		route, _ := entry.(map[string]interface{})
+		family := defaultRouteFamily(route)
+		if family == "" {
+			continue
+		}
+		name := stringField(route, "next-hop-interface")
+		if stringField(route, "state") != "absent" {
+			routes = append(routes, defaultRoute{family, name})
+			continue
+		}
+		for _, existing := range routes {
+			if existing.family == family && (name == "" || existing.iface == name) {
+				disabled[existing] = true
+			}
+		}
+	}
+
+	reasons := []string{}
+	for _, route := range routes {
+		switch {
+		case disabled[route]:
+			reasons = append(reasons, fmt.Sprintf("%s default route via %s would be removed", route.family, route.iface))
+		case !up[route.iface]:
+			reasons = append(reasons, fmt.Sprintf("%s default route via %s would be lost as the interface would not be up", route.family, route.iface))
+		default:
+			return false, nil, nil
+		}
+	}
+	return true, reasons, nil
+}
+
+// defaultRouteFamily returns the family of a main table default route, empty
+// for any other route.
+func defaultRouteFamily(route map[string]interface{}) string {
+	if table := numberField(route, "table-id", 0); table != 0 && table != mainRouteTable {
+		return ""
+	}
+	switch stringField(route, "destination") {
+	case "0.0.0.0/0":
+		return "ipv4"
+	case "::/0":
+		return "ipv6"
+	}
+	return ""
+}
+
+// RetrieveRouting retrieves the current network state and returns, in json
+// format, only its routes, running and config, and its route rules. A
+// section not reported by nmstate is left out.
+func (n *Nmstate) RetrieveRouting() (string, error) {
+	state, err := n.RetrieveNetState()
+	if err != nil {
+		return "", err
+	}
+	netState, err := decodeState(state)
+	if err != nil {
+		return "", err
+	}
+	routing := map[string]interface{}{}
+	for _, section := range []string{"routes", "route-rules"} {
+		if value, ok := netState[section]; ok {
+			routing[section] = value
+		}
+	}
+	encoded, err := json.Marshal(routing)
+	if err != nil {
+		return "", fmt.Errorf("failed encoding routing state: %v", err)
+	}
+	return n.indentJSON(string(encoded)), nil
+}
+
+// RouteRule is a policy routing rule from the route-rules section of a
+// network state. Numbers not set in the state are nil, fwmark and fwmask are
+// reported by nmstate as hex strings like "0x10" and the other numbers may
+// also be given as strings, all of them are accepted.
+type RouteRule struct {
+	Family               string
+	State                string
+	IPFrom               string
+	IPTo                 string
+	Priority             *int64
+	RouteTable           *uint32
+	FwMark               *uint32
+	FwMask               *uint32
+	Action               string
+	IIF                  string
+	SuppressPrefixLength *uint32
+}
+
+func (r *RouteRule) UnmarshalJSON(data []byte) error {
+	raw := struct {
+		Family               string          `json:"family"`
+		State                string          `json:"state"`
+		IPFrom               string          `json:"ip-from"`
+		IPTo                 string          `json:"ip-to"`
+		Priority             json.RawMessage `json:"priority"`
+		RouteTable           json.RawMessage `json:"route-table"`
+		FwMark               json.RawMessage `json:"fwmark"`
+		FwMask               json.RawMessage `json:"fwmask"`
+		Action               string          `json:"action"`
+		IIF                  string          `json:"iif"`
+		SuppressPrefixLength json.RawMessage `json:"suppress-prefix-length"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	rule := RouteRule{
+		Family: raw.Family,
+		State:  raw.State,
+		IPFrom: raw.IPFrom,
+		IPTo:   raw.IPTo,
+		Action: raw.Action,
+		IIF:    raw.IIF,
+	}
+	var err error
+	if rule.Priority, err = ruleInt64("priority", raw.Priority); err != nil {
+		return err
+	}
+	for _, field := range []struct {
+		name  string
+		raw   json.RawMessage
+		value **uint32
+	}{
+		{"route-table", raw.RouteTable, &rule.RouteTable},
+		{"fwmark", raw.FwMark, &rule.FwMark},
+		{"fwmask", raw.FwMask, &rule.FwMask},
+		{"suppress-prefix-length", raw.SuppressPrefixLength, &rule.SuppressPrefixLength},
+	} {
+		if *field.value, err = ruleUint32(field.name, field.raw); err != nil {
+			return err
+		}
+	}
+	*r = rule
+	return nil
+}
+
+// ruleNumberText returns the text of a route rule number given either as
+// json number or string, false when it is not set.
+func ruleNumberText(name string, raw json.RawMessage) (string, bool, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", false, nil
+	}
+	if raw[0] != '"' {
+		return string(raw), true, nil
+	}
+	text := ""
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return "", false, fmt.Errorf("invalid route rule %s %s: %v", name, raw, err)
+	}
+	return text, true, nil
+}
+
+func ruleInt64(name string, raw json.RawMessage) (*int64, error) {
+	text, ok, err := ruleNumberText(name, raw)
+	if !ok || err != nil {
+		return nil, err
+	}
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route rule %s %s: %v", name, raw, err)
+	}
+	return &value, nil
+}
+
+// ruleUint32 parses a decimal number or, like nmstate, a hex one prefixed
+// with 0x.
+func ruleUint32(name string, raw json.RawMessage) (*uint32, error) {
+	text, ok, err := ruleNumberText(name, raw)
+	if !ok || err != nil {
+		return nil, err
+	}
+	base := 10
+	if strings.HasPrefix(text, "0x") {
+		text, base = text[2:], 16
+	}
+	value, err := strconv.ParseUint(text, base, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route rule %s %s: %v", name, raw, err)
+	}
+	value32 := uint32(value)
+	return &value32, nil
+}
+
+// RouteRules returns the route rules configured in the network state in
+// json format, an empty list when it has none.
+func RouteRules(state string) ([]RouteRule, error) {
+	routing := struct {
+		RouteRules struct {
+			Config []RouteRule `json:"config"`
+		} `json:"route-rules"`
+	}{}
+	if err := json.Unmarshal([]byte(state), &routing); err != nil {
+		return nil, fmt.Errorf("failed parsing route rules: %v", err)
+	}
+	if routing.RouteRules.Config == nil {
+		return []RouteRule{}, nil
+	}
+	return routing.RouteRules.Config, nil
+}
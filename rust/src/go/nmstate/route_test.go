@@ -0,0 +1,120 @@
+package nmstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultRouteInterfacesSingleStack(t *testing.T) {
+	v4iface, v6iface, err := DefaultRouteInterfaces(`{
+"routes": {"running": [
+  {"destination": "0.0.0.0/0", "next-hop-interface": "eth2", "next-hop-address": "192.0.2.1", "metric": 200, "table-id": 254},
+  {"destination": "0.0.0.0/0", "next-hop-interface": "eth1", "next-hop-address": "192.0.2.1", "metric": 100, "table-id": 254},
+  {"destination": "0.0.0.0/0", "next-hop-interface": "eth3", "next-hop-address": "192.0.2.1", "metric": 10, "table-id": 100},
+  {"destination": "198.51.100.0/24", "next-hop-interface": "eth3", "metric": 0}
+]}
+}`)
+	assert.NoError(t, err, "must succeed finding default route interfaces")
+	assert.Equal(t, "eth1", v4iface, "default route with lowest metric should win")
+	assert.Empty(t, v6iface, "state should have no IPv6 default route")
+}
+
+func TestDefaultRouteInterfacesDualStack(t *testing.T) {
+	v4iface, v6iface, err := DefaultRouteInterfaces(`{
+"routes": {"config": [
+  {"destination": "0.0.0.0/0", "next-hop-interface": "eth1", "next-hop-address": "192.0.2.1"},
+  {"destination": "::/0", "next-hop-interface": "eth2", "next-hop-address": "2001:db8::1"}
+]}
+}`)
+	assert.NoError(t, err, "must succeed finding default route interfaces")
+	assert.Equal(t, "eth1", v4iface)
+	assert.Equal(t, "eth2", v6iface)
+}
+
+const isolationCurrentState = `{
+"interfaces": [
+  {"name": "eth1", "type": "ethernet", "state": "up"},
+  {"name": "eth2", "type": "ethernet", "state": "up"}
+],
+"routes": {"running": [
+  {"destination": "0.0.0.0/0", "next-hop-interface": "eth1", "next-hop-address": "192.0.2.1", "table-id": 254},
+  {"destination": "198.51.100.0/24", "next-hop-interface": "eth2", "table-id": 254}
+]}
+}`
+
+func TestWouldIsolateHostSafe(t *testing.T) {
+	isolated, reasons, err := wouldIsolateHost(isolationCurrentState, `{
+"interfaces": [{"name": "eth2", "type": "ethernet", "state": "down"}]
+}`)
+	assert.NoError(t, err, "must succeed checking isolation")
+	assert.False(t, isolated, "keeping the default route interface up must be safe")
+	assert.Empty(t, reasons)
+
+	isolated, _, err = wouldIsolateHost(isolationCurrentState, `{
+"interfaces": [{"name": "eth1", "type": "ethernet", "state": "down"}],
+"routes": {"config": [{"destination": "0.0.0.0/0", "next-hop-interface": "eth2", "next-hop-address": "192.0.2.1"}]}
+}`)
+	assert.NoError(t, err, "must succeed checking isolation")
+	assert.False(t, isolated, "moving the default route to another up interface must be safe")
+}
+
+func TestWouldIsolateHost(t *testing.T) {
+	isolated, reasons, err := wouldIsolateHost(isolationCurrentState, `{
+"interfaces": [{"name": "eth1", "state": "absent"}]
+}`)
+	assert.NoError(t, err, "must succeed checking isolation")
+	assert.True(t, isolated, "removing the last default route interface must isolate the host")
+	assert.Equal(t, []string{"ipv4 default route via eth1 would be lost as the interface would not be up"}, reasons)
+
+	isolated, reasons, err = wouldIsolateHost(isolationCurrentState, `{
+"routes": {"config": [{"destination": "0.0.0.0/0", "state": "absent"}]}
+}`)
+	assert.NoError(t, err, "must succeed checking isolation")
+	assert.True(t, isolated, "removing the last default route must isolate the host")
+	assert.Equal(t, []string{"ipv4 default route via eth1 would be removed"}, reasons)
+}
+
+func TestRouteRules(t *testing.T) {
+	rules, err := RouteRules(`{
+"routes": {"config": []},
+"route-rules": {"config": [
+  {"ip-from": "192.0.2.0/24", "priority": 1000, "route-table": 100},
+  {"family": "ipv6", "iif": "eth1", "priority": "0", "route-table": "200", "fwmark": "0x10", "fwmask": "0xff", "action": "blackhole", "suppress-prefix-length": 0},
+  {"ip-to": "198.51.100.0/24", "fwmark": 16}
+]}
+}`)
+	assert.NoError(t, err, "must succeed parsing route rules")
+	priority, zero := int64(1000), int64(0)
+	table100, table200, mark, mask, suppress := uint32(100), uint32(200), uint32(16), uint32(255), uint32(0)
+	assert.Equal(t, []RouteRule{
+		{IPFrom: "192.0.2.0/24", Priority: &priority, RouteTable: &table100},
+		{Family: "ipv6", IIF: "eth1", Priority: &zero, RouteTable: &table200, FwMark: &mark, FwMask: &mask, Action: "blackhole", SuppressPrefixLength: &suppress},
+		{IPTo: "198.51.100.0/24", FwMark: &mark},
+	}, rules, "zero values must be told apart from unset ones")
+}
+
+func TestRouteRulesInvalidNumber(t *testing.T) {
+	_, err := RouteRules(`{"route-rules": {"config": [{"fwmark": "0xzz"}]}}`)
+	assert.EqualError(t, err, `failed parsing route rules: invalid route rule fwmark "0xzz": strconv.ParseUint: parsing "zz": invalid syntax`)
+}
+
+func TestRouteRulesWithoutRules(t *testing.T) {
+	rules, err := RouteRules(`{"routes": {"running": [{"destination": "0.0.0.0/0", "next-hop-interface": "eth1"}]}}`)
+	assert.NoError(t, err, "must succeed parsing a state without route rules")
+	assert.Empty(t, rules)
+
+	rules, err = RouteRules(`{"route-rules": {}}`)
+	assert.NoError(t, err, "must succeed parsing empty route rules")
+	assert.Empty(t, rules)
+}
+
+func TestRetrieveRouting(t *testing.T) {
+	routing, err := New().RetrieveRouting()
+	assert.NoError(t, err, "must succeed retrieving routing")
+	assert.NotContains(t, routing, `"interfaces"`, "routing must not contain interfaces")
+	assert.Contains(t, routing, `"routes"`)
+
+	_, err = RouteRules(routing)
+	assert.NoError(t, err, "must succeed parsing retrieved route rules")
+}
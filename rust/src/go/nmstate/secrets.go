@@ -0,0 +1,256 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redactedValue is the value nmstate itself reports in place of secrets.
+const redactedValue = "<_password_hid_by_nmstate>"
+
+// secretFields are the state properties holding secrets, hidden from the
+// recorded calls, the errors, the logs and the applied state.
+var secretFields = map[string]bool{
+	"password":             true,
+	"private-key-password": true,
+	"psk":                  true,
+	"mka-cak":              true,
+}
+
+// yamlSecretLine matches a secretFields key with its value on one line of a
+// block style yaml state, yamlSecretKey any other mention of such a key.
+var yamlSecretLine, yamlSecretKey = func() (*regexp.Regexp, *regexp.Regexp) {
+	keys := make([]string, 0, len(secretFields))
+	for key := range secretFields {
+		keys = append(keys, regexp.QuoteMeta(key))
+	}
+	sort.Strings(keys)
+	alternatives := strings.Join(keys, "|")
+	return regexp.MustCompile(`^(\s*(?:-\s+)?(?:` + alternatives + `)\s*:\s+)(\S.*?)\s*$`),
+		regexp.MustCompile(`(?:` + alternatives + `)["']?\s*:`)
+}()
+
+// redactInput redacts the secretFields of the states provided to apply and
+// generate-configuration.
+func redactInput(op, input string) string {
+	if op != applyOp && op != genconfOp {
+		return input
+	}
+	return redactState(input)
+}
+
+// redactState replaces the secretFields of the state with redactedValue. A
+// state which is not json is redacted like redactYAML.
+func redactState(state string) string {
+	netState, err := decodeState(state)
+	if err != nil {
+		redacted, _ := redactYAML(state)
+		return redacted
+	}
+	redactSecrets(netState)
+	var redacted strings.Builder
+	encoder := json.NewEncoder(&redacted)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(netState); err != nil {
+		return redactedValue
+	}
+	return strings.TrimSuffix(redacted.String(), "\n")
+}
+
+func redactSecrets(value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if _, ok := field.(string); ok && secretFields[key] {
+				value[key] = redactedValue
+				continue
+			}
+			redactSecrets(field)
+		}
+	case []interface{}:
+		for _, entry := range value {
+			redactSecrets(entry)
+		}
+	}
+}
+
+// secretValues returns the values of the secretFields set in the state, to
+// be hidden from the text reported by libnmstate.
+func secretValues(state string) []string {
+	secrets := []string{}
+	if netState, err := decodeState(state); err == nil {
+		collectSecrets(netState, &secrets)
+	} else {
+		_, secrets = redactYAML(state)
+	}
+	// Match the longest first so a secret containing another one is hidden
+	// entirely.
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	return secrets
+}
+
+// redactYAML replaces the values of the secretFields of a yaml state with
+// redactedValue and returns them. Only plain or quoted values written on the
+// line of their key, as nmstate itself writes them, are understood: any other
+// mention of a secret key, like in a flow style mapping, makes the whole state
+// redacted and its secrets unknown. A state without secret key is returned
+// untouched.
+func redactYAML(state string) (string, []string) {
+	lines := strings.Split(state, "\n")
+	secrets := []string{}
+	for i, line := range lines {
+		match := yamlSecretLine.FindStringSubmatch(line)
+		if match == nil {
+			if yamlSecretKey.MatchString(line) {
+				return redactedValue, nil
+			}
+			continue
+		}
+		secret, ok := yamlScalar(match[2])
+		if !ok {
+			return redactedValue, nil
+		}
+		if secret != "" && secret != redactedValue {
+			secrets = append(secrets, secret)
+		}
+		lines[i] = match[1] + redactedValue
+	}
+	return strings.Join(lines, "\n"), secrets
+}
+
+// yamlScalar returns the string of a single line yaml scalar, without its
+// quotes or trailing comment, or false for anything else like a block scalar.
+func yamlScalar(value string) (string, bool) {
+	quoted := ""
+	switch value[0] {
+	case '"':
+		for i := 1; i < len(value); i++ {
+			if value[i] == '\\' {
+				i++
+			} else if value[i] == '"' {
+				quoted, value = value[:i+1], value[i+1:]
+				break
+			}
+		}
+	case '\'':
+		for i := 1; i < len(value); i++ {
+			if value[i] != '\'' {
+				continue
+			}
+			if i+1 < len(value) && value[i+1] == '\'' {
+				i++
+				continue
+			}
+			quoted, value = value[:i+1], value[i+1:]
+			break
+		}
+	case '|', '>', '&', '*', '!', '{', '[', '#':
+		return "", false
+	default:
+		if plain, _, found := cutString(value, " #"); found {
+			return strings.TrimSpace(plain), true
+		}
+		return value, true
+	}
+	if quoted == "" {
+		return "", false
+	}
+	if rest := strings.TrimSpace(value); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", false
+	}
+	if quoted[0] == '\'' {
+		return strings.ReplaceAll(quoted[1:len(quoted)-1], "''", "'"), true
+	}
+	var unquoted string
+	if err := json.Unmarshal([]byte(quoted), &unquoted); err != nil {
+		return "", false
+	}
+	return unquoted, true
+}
+
+func collectSecrets(value interface{}, secrets *[]string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if secret, ok := field.(string); ok && secretFields[key] {
+				if secret != "" && secret != redactedValue {
+					*secrets = append(*secrets, secret)
+				}
+				continue
+			}
+			collectSecrets(field, secrets)
+		}
+	case []interface{}:
+		for _, entry := range value {
+			collectSecrets(entry, secrets)
+		}
+	}
+}
+
+// minHiddenSecretLength is the length under which a secret is only hidden
+// as a quoted json value: a short secret like "on" also appears in plenty of
+// words of the text.
+const minHiddenSecretLength = 6
+
+// hideSecrets replaces the secrets provided in the text reported by
+// libnmstate with redactedValue.
+func hideSecrets(text string, secrets []string) string {
+	if len(secrets) == 0 {
+		return text
+	}
+	replacements := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		if len(secret) >= minHiddenSecretLength {
+			replacements = append(replacements, secret, redactedValue)
+			continue
+		}
+		quoted, err := json.Marshal(secret)
+		if err != nil {
+			continue
+		}
+		replacements = append(replacements, string(quoted), `"`+redactedValue+`"`)
+	}
+	return strings.NewReplacer(replacements...).Replace(text)
+}
+
+// validateMACsec checks the length of the MACsec keys, as a wrong key is
+// otherwise only reported by the kernel once applied. Keys already redacted
+// are ignored, a state which is not json is left to libnmstate. The bundled
+// libnmstate has no macsec interface type yet, so such states are rejected
+// by libnmstate anyway until it does.
+func validateMACsec(state string) error {
+	netState, err := decodeState(state)
+	if err != nil {
+		return nil
+	}
+	for _, iface := range stateInterfaces(netState) {
+		if stringField(iface, "type") != "macsec" {
+			continue
+		}
+		name := stringField(iface, "name")
+		macsec, _ := iface["macsec"].(map[string]interface{})
+		cak := stringField(macsec, "mka-cak")
+		if cak != "" && cak != redactedValue && ((len(cak) != 32 && len(cak) != 64) || !isHex(cak)) {
+			return fmt.Errorf("invalid mka-cak of macsec interface %s: must be 32 or 64 hexadecimal characters", name)
+		}
+		ckn := stringField(macsec, "mka-ckn")
+		if ckn != "" && (len(ckn) < 2 || len(ckn) > 64 || len(ckn)%2 != 0 || !isHex(ckn)) {
+			return fmt.Errorf("invalid mka-ckn of macsec interface %s: must be an even number of 2 to 64 hexadecimal characters", name)
+		}
+	}
+	return nil
+}
+
+func isHex(value string) bool {
+	for _, c := range value {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
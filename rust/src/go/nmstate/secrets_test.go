@@ -0,0 +1,103 @@
+package nmstate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const macsecCAK = "50b71a8ef0bd5751ea76de6d6c98c03a"
+
+func TestRedactInput(t *testing.T) {
+	assert.Equal(t, "/run/checkpoint/1", redactInput(commitOp, "/run/checkpoint/1"), "checkpoint paths must be kept")
+	assert.Equal(t, "psk: "+redactedValue, redactInput(applyOp, "psk: secret"), "yaml secrets must be redacted")
+	assert.Equal(t, redactedValue, redactInput(applyOp, "wifi: {psk: secret}"), "states with secrets that cannot be parsed must be fully redacted")
+	assert.Equal(t, "interfaces: []\n", redactInput(applyOp, "interfaces: []\n"), "yaml states without secrets must be kept")
+	assert.Equal(t, `{"interfaces":[{"wifi":{"psk":"<_password_hid_by_nmstate>"}}]}`, redactInput(genconfOp, `{"interfaces": [{"wifi": {"psk": "secret"}}]}`))
+}
+
+func TestApplyMACsecRedactsKeys(t *testing.T) {
+	var logs bytes.Buffer
+	nms := New(WithLogsWritter(&logs))
+	_, err := nms.ApplyNetState(`{"interfaces": [{
+"name": "macsec0", "type": "macsec", "state": "up",
+"macsec": {"base-iface": "nonexistent0", "mka-cak": "` + macsecCAK + `", "mka-ckn": "f2b4297d39da7330910a74abc0449feb45b5c0b9fc23df1430e1898fcf1c4550"}
+}]}`)
+	require.Error(t, err, "must fail applying macsec over a nonexistent interface")
+	assert.NotContains(t, err.Error(), macsecCAK, "mka-cak must be hidden from the error")
+	assert.Contains(t, err.Error(), `"mka-cak":"<_password_hid_by_nmstate>"`)
+	assert.NotContains(t, logs.String(), macsecCAK, "mka-cak must be hidden from the logs")
+}
+
+func TestValidateMACsec(t *testing.T) {
+	macsecState := func(cak, ckn string) string {
+		return `{"interfaces": [{"name": "macsec0", "type": "macsec", "macsec": {"mka-cak": "` + cak + `", "mka-ckn": "` + ckn + `"}}]}`
+	}
+	assert.NoError(t, validateMACsec(macsecState(macsecCAK, "f2b4")))
+	assert.NoError(t, validateMACsec(macsecState(macsecCAK+macsecCAK, "f2")))
+	assert.NoError(t, validateMACsec(macsecState(redactedValue, "f2")), "redacted keys must be ignored")
+	assert.NoError(t, validateMACsec(`macsec: [`), "states which are not json must be left to libnmstate")
+
+	err := validateMACsec(macsecState("50b71a8e", "f2"))
+	assert.EqualError(t, err, "invalid mka-cak of macsec interface macsec0: must be 32 or 64 hexadecimal characters")
+	assert.NotContains(t, err.Error(), "50b71a8e", "the error must not contain the key")
+
+	err = validateMACsec(macsecState(macsecCAK[:31]+"z", "f2"))
+	assert.EqualError(t, err, "invalid mka-cak of macsec interface macsec0: must be 32 or 64 hexadecimal characters")
+
+	err = validateMACsec(macsecState(macsecCAK, "f2b"))
+	assert.EqualError(t, err, "invalid mka-ckn of macsec interface macsec0: must be an even number of 2 to 64 hexadecimal characters")
+
+	_, err = New().ApplyNetState(macsecState("00", "f2"))
+	assert.EqualError(t, err, "invalid mka-cak of macsec interface macsec0: must be 32 or 64 hexadecimal characters", "invalid keys must be rejected before reaching libnmstate")
+}
+
+func TestHideSecrets(t *testing.T) {
+	secrets := secretValues(`{"interfaces": [{"802.1x": {"password": "s3cr3t", "private-key-password": "s3cr3t-key"}}, {"wifi": {"psk": "<_password_hid_by_nmstate>"}}]}`)
+	assert.Equal(t, []string{"s3cr3t-key", "s3cr3t"}, secrets, "longest secrets must come first and redacted ones be skipped")
+	assert.Equal(t, "bad key <_password_hid_by_nmstate>, bad password <_password_hid_by_nmstate>",
+		hideSecrets("bad key s3cr3t-key, bad password s3cr3t", secrets))
+}
+
+func TestHideShortSecrets(t *testing.T) {
+	assert.Equal(t, `connection failed: {"psk":"<_password_hid_by_nmstate>"}`,
+		hideSecrets(`connection failed: {"psk":"on"}`, []string{"on"}), "short secrets must only be hidden as quoted values")
+}
+
+func TestRedactYAML(t *testing.T) {
+	state := `interfaces:
+- name: wlan0
+  type: wifi
+  wifi:
+    psk: "s3cr3t\\\"key"
+- name: eth1
+  802.1x:
+    password: 'it''s a s3cr3t' # hand written
+    private-key-password: plain-s3cr3t
+- name: macsec0
+  macsec:
+    mka-cak: <_password_hid_by_nmstate>
+`
+	redacted, secrets := redactYAML(state)
+	assert.Equal(t, `interfaces:
+- name: wlan0
+  type: wifi
+  wifi:
+    psk: <_password_hid_by_nmstate>
+- name: eth1
+  802.1x:
+    password: <_password_hid_by_nmstate>
+    private-key-password: <_password_hid_by_nmstate>
+- name: macsec0
+  macsec:
+    mka-cak: <_password_hid_by_nmstate>
+`, redacted)
+	assert.Equal(t, []string{`s3cr3t\"key`, "it's a s3cr3t", "plain-s3cr3t"}, secrets)
+	assert.Equal(t, []string{"it's a s3cr3t", "plain-s3cr3t", `s3cr3t\"key`}, secretValues(state), "yaml secrets must be hidden from the logs, longest first")
+
+	redacted, secrets = redactYAML("wifi:\n  psk: |\n    s3cr3t\n")
+	assert.Equal(t, redactedValue, redacted, "block scalar secrets must fully redact the state")
+	assert.Empty(t, secrets)
+}
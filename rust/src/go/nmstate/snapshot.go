@@ -0,0 +1,45 @@
+package nmstate
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+const snapshotTimeFormat = "20060102T150405.000000000Z"
+
+// SaveSnapshot retrieves the network state in json format and writes it to
+// dir in a file named after name and the current UTC time. This function
+// returns the path of the snapshot or an error.
+func (n *Nmstate) SaveSnapshot(dir, name string) (string, error) {
+	state, err := n.RetrieveNetState()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.json", name, time.Now().UTC().Format(snapshotTimeFormat)))
+	if err := writeFileAtomic(path, state); err != nil {
+		return "", fmt.Errorf("failed writing snapshot %s: %v", path, err)
+	}
+	return path, nil
+}
+
+// ApplyWithSnapshots saves a "before" snapshot of the network state into dir,
+// applies the network state in json format and saves an "after" snapshot,
+// also when the apply failed. This function returns the applied network
+// state or an error.
+func (n *Nmstate) ApplyWithSnapshots(state, dir string) (string, error) {
+	if _, err := n.SaveSnapshot(dir, "before"); err != nil {
+		return "", err
+	}
+	applied, err := n.ApplyNetState(state)
+	if _, snapshotErr := n.SaveSnapshot(dir, "after"); snapshotErr != nil {
+		if err != nil {
+			return "", fmt.Errorf("%v, saving after snapshot also failed: %v", err, snapshotErr)
+		}
+		return "", snapshotErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return applied, nil
+}
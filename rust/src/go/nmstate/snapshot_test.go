@@ -0,0 +1,39 @@
+package nmstate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyWithSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	nms := New()
+	_, err := nms.ApplyNetState(`{"interfaces": [{"name": "dummy5", "state": "absent"}]}`)
+	assert.NoError(t, err, "must succeed calling nmstate_net_state_apply c binding")
+
+	_, err = nms.ApplyWithSnapshots(`{
+"interfaces": [{
+  "name": "dummy5",
+  "state": "up",
+  "type": "dummy"
+}]}
+`, dir)
+	assert.NoError(t, err, "must succeed applying with snapshots")
+
+	before, err := filepath.Glob(filepath.Join(dir, "before-*.json"))
+	assert.NoError(t, err)
+	assert.Len(t, before, 1, "before snapshot must be written")
+	after, err := filepath.Glob(filepath.Join(dir, "after-*.json"))
+	assert.NoError(t, err)
+	assert.Len(t, after, 1, "after snapshot must be written")
+
+	content, err := os.ReadFile(before[0])
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), `"dummy5"`, "before snapshot must not have the change")
+	content, err = os.ReadFile(after[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"dummy5"`, "after snapshot must have the change")
+}
@@ -0,0 +1,446 @@
+package nmstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// decodeState parses a network state in json format keeping numbers as
+// json.Number so they are not altered when the state is encoded back.
+func decodeState(state string) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(state))
+	decoder.UseNumber()
+	netState := map[string]interface{}{}
+	if err := decoder.Decode(&netState); err != nil {
+		return nil, fmt.Errorf("failed parsing net state: %v", err)
+	}
+	return netState, nil
+}
+
+// stateInterfaces returns the entries of the interfaces section of a
+// decoded network state, skipping anything that is not an object.
+func stateInterfaces(netState map[string]interface{}) []map[string]interface{} {
+	list, _ := netState["interfaces"].([]interface{})
+	ifaces := make([]map[string]interface{}, 0, len(list))
+	for _, entry := range list {
+		if iface, ok := entry.(map[string]interface{}); ok {
+			ifaces = append(ifaces, iface)
+		}
+	}
+	return ifaces
+}
+
+// GlobalStateKey is the SplitByInterface key holding everything in the state
+// that is not an interface, like routes, route rules and DNS. Interface
+// names cannot be empty so it never collides with an interface entry.
+const GlobalStateKey = ""
+
+type splitDocument struct {
+	name  string
+	state map[string]interface{}
+}
+
+// SplitByInterface splits the network state in json format into one
+// independently applicable document per interface name plus a document
+// stored under GlobalStateKey with the remaining sections. Routes, route
+// rules and DNS are never attributed to an interface, even when they
+// reference one through next-hop-interface, they all go to the global
+// document. Interfaces sharing a name, like an ovs-bridge and its
+// ovs-interface, are kept together in the same document.
+func SplitByInterface(state string) (map[string]string, error) {
+	docs, err := splitByInterface(state)
+	if err != nil {
+		return nil, err
+	}
+	split := map[string]string{}
+	for _, doc := range docs {
+		encoded, err := json.Marshal(doc.state)
+		if err != nil {
+			return nil, fmt.Errorf("failed encoding state of %q: %v", doc.name, err)
+		}
+		split[doc.name] = string(encoded)
+	}
+	return split, nil
+}
+
+// splitByInterface returns the split documents in the order the interfaces
+// appear in the state, followed by the global document if any.
+func splitByInterface(state string) ([]splitDocument, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+	docs := []splitDocument{}
+	index := map[string]int{}
+	for _, iface := range stateInterfaces(netState) {
+		name := stringField(iface, "name")
+		if name == "" {
+			return nil, fmt.Errorf("interface without name in net state: %v", iface)
+		}
+		if i, ok := index[name]; ok {
+			docs[i].state["interfaces"] = append(docs[i].state["interfaces"].([]interface{}), iface)
+			continue
+		}
+		index[name] = len(docs)
+		docs = append(docs, splitDocument{
+			name:  name,
+			state: map[string]interface{}{"interfaces": []interface{}{iface}},
+		})
+	}
+	global := map[string]interface{}{}
+	for key, value := range netState {
+		if key != "interfaces" {
+			global[key] = value
+		}
+	}
+	if len(global) > 0 {
+		docs = append(docs, splitDocument{name: GlobalStateKey, state: global})
+	}
+	return docs, nil
+}
+
+func filterInterfacesByType(state, ifType string) (string, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return "", err
+	}
+	ifaces := []interface{}{}
+	for _, iface := range stateInterfaces(netState) {
+		if stringField(iface, "type") == ifType {
+			ifaces = append(ifaces, iface)
+		}
+	}
+	filtered, err := json.Marshal(map[string]interface{}{"interfaces": ifaces})
+	if err != nil {
+		return "", fmt.Errorf("failed encoding %s interfaces: %v", ifType, err)
+	}
+	return string(filtered), nil
+}
+
+// readOnlyInterfaceFields are the interface properties reported by nmstate
+// but ignored when applying. Nested properties are separated by dots.
+var readOnlyInterfaceFields = []string{
+	"min-mtu",
+	"max-mtu",
+	"permanent-mac-address",
+	"lldp.neighbors",
+}
+
+// StripReadOnly returns the network state in json format without the
+// interface properties nmstate reports but ignores on apply: min-mtu,
+// max-mtu, permanent-mac-address and lldp.neighbors.
+func StripReadOnly(state string) (string, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range stateInterfaces(netState) {
+		removeFields(iface, readOnlyInterfaceFields)
+	}
+	stripped, err := json.Marshal(netState)
+	if err != nil {
+		return "", fmt.Errorf("failed encoding net state: %v", err)
+	}
+	return string(stripped), nil
+}
+
+func removeFields(object map[string]interface{}, fields []string) {
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+		parent := object
+		for _, key := range path[:len(path)-1] {
+			parent, _ = parent[key].(map[string]interface{})
+		}
+		if parent != nil {
+			delete(parent, path[len(path)-1])
+		}
+	}
+}
+
+// InterfaceTypeHistogram returns the number of interfaces per interface type
+// in the network state in json format. Interfaces without type are counted
+// as "unknown", the type nmstate assumes for them.
+func InterfaceTypeHistogram(state string) (map[string]int, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+	histogram := map[string]int{}
+	for _, iface := range stateInterfaces(netState) {
+		ifType := stringField(iface, "type")
+		if ifType == "" {
+			ifType = "unknown"
+		}
+		histogram[ifType]++
+	}
+	return histogram, nil
+}
+
+// CompactState returns the network state in json format without any
+// insignificant whitespace, for logging it on a single line. It ignores
+// WithJSONIndent.
+func CompactState(state string) (string, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(state)); err != nil {
+		return "", fmt.Errorf("failed compacting net state: %v", err)
+	}
+	return compact.String(), nil
+}
+
+// routeSortKeys and routeRuleSortKeys are the properties, in order of
+// precedence, SortInterfaces sorts routes and route rules by.
+var (
+	routeSortKeys     = []string{"table-id", "destination", "next-hop-interface", "next-hop-address", "metric"}
+	routeRuleSortKeys = []string{"priority", "route-table", "ip-from", "ip-to"}
+)
+
+// SortInterfaces returns the network state in json format with its
+// interfaces sorted by name then type, and its running and config routes and
+// route rules sorted by routeSortKeys and routeRuleSortKeys. Entries missing a
+// property sort first, numbers are compared by value. DNS servers and
+// searches are kept in their order as it sets their preference. All fields are
+// preserved and sorting a sorted state returns it unchanged.
+func SortInterfaces(state string) (string, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return "", err
+	}
+	if ifaces, ok := netState["interfaces"].([]interface{}); ok {
+		sortObjects(ifaces, []string{"name", "type"})
+	}
+	for section, keys := range map[string][]string{"routes": routeSortKeys, "route-rules": routeRuleSortKeys} {
+		object, _ := netState[section].(map[string]interface{})
+		for _, list := range []string{"running", "config"} {
+			if entries, ok := object[list].([]interface{}); ok {
+				sortObjects(entries, keys)
+			}
+		}
+	}
+	sorted, err := json.Marshal(netState)
+	if err != nil {
+		return "", fmt.Errorf("failed encoding sorted net state: %v", err)
+	}
+	return string(sorted), nil
+}
+
+func sortObjects(list []interface{}, keys []string) {
+	sort.SliceStable(list, func(i, j int) bool {
+		a, _ := list[i].(map[string]interface{})
+		b, _ := list[j].(map[string]interface{})
+		for _, key := range keys {
+			if c := compareFields(a[key], b[key]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// compareFields orders missing values first, then numbers by value, then
+// anything else by its string form.
+func compareFields(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	aNumber, aErr := toFloat(a)
+	bNumber, bErr := toFloat(b)
+	if aErr == nil && bErr == nil {
+		switch {
+		case aNumber < bNumber:
+			return -1
+		case aNumber > bNumber:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat(value interface{}) (float64, error) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("not a number: %v", value)
+	}
+	return number.Float64()
+}
+
+// dropMissingAbsent removes from the desired state the interfaces marked as
+// absent which are not in the current state.
+func dropMissingAbsent(desired, current string) (string, error) {
+	desiredState, err := decodeState(desired)
+	if err != nil {
+		return "", err
+	}
+	currentState, err := decodeState(current)
+	if err != nil {
+		return "", err
+	}
+	existing := map[string]bool{}
+	for _, iface := range stateInterfaces(currentState) {
+		existing[stringField(iface, "name")] = true
+	}
+	if _, ok := desiredState["interfaces"]; !ok {
+		return desired, nil
+	}
+	ifaces := []interface{}{}
+	for _, iface := range stateInterfaces(desiredState) {
+		if stringField(iface, "state") == "absent" && !existing[stringField(iface, "name")] {
+			continue
+		}
+		ifaces = append(ifaces, iface)
+	}
+	desiredState["interfaces"] = ifaces
+	encoded, err := json.Marshal(desiredState)
+	if err != nil {
+		return "", fmt.Errorf("failed encoding net state: %v", err)
+	}
+	return string(encoded), nil
+}
+
+// checkManagedInterfaces fails if WithManagedInterfaces is set and the state
+// references an interface outside of it, see referencedInterfaces.
+func (n *Nmstate) checkManagedInterfaces(state string) error {
+	if n.managedInterfaces == nil {
+		return nil
+	}
+	netState, err := decodeState(state)
+	if err != nil {
+		return err
+	}
+	disallowed := []string{}
+	for name := range referencedInterfaces(netState) {
+		if !n.managedInterfaces[name] {
+			disallowed = append(disallowed, name)
+		}
+	}
+	if len(disallowed) > 0 {
+		sort.Strings(disallowed)
+		return fmt.Errorf("net state references interfaces not managed by this client: %s", strings.Join(disallowed, ", "))
+	}
+	return nil
+}
+
+// referencedInterfaces returns the names of the interfaces a network state
+// changes or depends on: the interfaces themselves, their controller, ports,
+// veth and OVS patch peer and base interface, the next-hop-interface of the
+// routes, the iif of the route rules and the interface of IPv6 link-local DNS
+// servers. Team, ipvlan and macsec interfaces are covered although the
+// bundled libnmstate does not support them yet.
+func referencedInterfaces(netState map[string]interface{}) map[string]bool {
+	referenced := map[string]bool{}
+	add := func(name string) {
+		if name != "" {
+			referenced[name] = true
+		}
+	}
+	for _, iface := range stateInterfaces(netState) {
+		add(stringField(iface, "name"))
+		add(stringField(iface, "controller"))
+		for _, port := range interfacePorts(iface) {
+			add(port)
+		}
+		team, _ := iface["team"].(map[string]interface{})
+		teamPorts, _ := team["ports"].([]interface{})
+		for _, entry := range teamPorts {
+			port, _ := entry.(map[string]interface{})
+			add(stringField(port, "name"))
+		}
+		vrf, _ := iface["vrf"].(map[string]interface{})
+		vrfPorts, _ := vrf["port"].([]interface{})
+		for _, port := range vrfPorts {
+			name, _ := port.(string)
+			add(name)
+		}
+		// OVS bonds are ports of an ovs-bridge, holding their own ports.
+		bridge, _ := iface["bridge"].(map[string]interface{})
+		bridgePorts, _ := bridge["port"].([]interface{})
+		for _, entry := range bridgePorts {
+			port, _ := entry.(map[string]interface{})
+			bond, _ := port["link-aggregation"].(map[string]interface{})
+			bondPorts, _ := bond["port"].([]interface{})
+			for _, bondPort := range bondPorts {
+				bondPort, _ := bondPort.(map[string]interface{})
+				add(stringField(bondPort, "name"))
+			}
+		}
+		for _, section := range []string{"vlan", "vxlan", "mac-vlan", "mac-vtap", "ipvlan", "macsec", "infiniband"} {
+			config, _ := iface[section].(map[string]interface{})
+			add(stringField(config, "base-iface"))
+		}
+		for _, section := range []string{"veth", "patch"} {
+			config, _ := iface[section].(map[string]interface{})
+			add(stringField(config, "peer"))
+		}
+	}
+	for _, route := range sectionConfig(netState, "routes") {
+		add(stringField(route, "next-hop-interface"))
+	}
+	for _, rule := range sectionConfig(netState, "route-rules") {
+		add(stringField(rule, "iif"))
+	}
+	dns, _ := netState["dns-resolver"].(map[string]interface{})
+	dnsConfig, _ := dns["config"].(map[string]interface{})
+	servers, _ := dnsConfig["server"].([]interface{})
+	for _, server := range servers {
+		server, _ := server.(string)
+		if _, iface, found := cutString(server, "%"); found {
+			add(iface)
+		}
+	}
+	return referenced
+}
+
+// sectionConfig returns the config entries of the routes or route-rules
+// section of a decoded network state, skipping anything that is not an
+// object.
+func sectionConfig(netState map[string]interface{}, section string) []map[string]interface{} {
+	object, _ := netState[section].(map[string]interface{})
+	list, _ := object["config"].([]interface{})
+	entries := make([]map[string]interface{}, 0, len(list))
+	for _, entry := range list {
+		if entry, ok := entry.(map[string]interface{}); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func stringField(object map[string]interface{}, key string) string {
+	value, _ := object[key].(string)
+	return value
+}
+
+// EthtoolFeatures returns the ethtool feature flags reported for the
+// interface named iface in the network state in json format. An interface
+// without ethtool data returns an empty map.
+func EthtoolFeatures(state, iface string) (map[string]bool, error) {
+	netState, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range stateInterfaces(netState) {
+		if stringField(entry, "name") != iface {
+			continue
+		}
+		features := map[string]bool{}
+		ethtool, _ := entry["ethtool"].(map[string]interface{})
+		list, _ := ethtool["feature"].(map[string]interface{})
+		for name, value := range list {
+			enabled, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("invalid ethtool feature %s of interface %s: %v", name, iface, value)
+			}
+			features[name] = enabled
+		}
+		return features, nil
+	}
+	return nil, fmt.Errorf("interface %s not found in net state", iface)
+}
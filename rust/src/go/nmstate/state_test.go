@@ -0,0 +1,311 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEthtoolFeatures(t *testing.T) {
+	state := `{
+"interfaces": [{
+  "name": "eth1",
+  "type": "ethernet",
+  "state": "up",
+  "ethtool": {
+    "feature": {
+      "rx-checksum": true,
+      "tx-tcp-segmentation": false
+    }
+  }
+}, {
+  "name": "lo",
+  "type": "loopback",
+  "state": "up"
+}]}
+`
+	features, err := EthtoolFeatures(state, "eth1")
+	assert.NoError(t, err, "must succeed parsing ethtool features")
+	assert.Equal(t, map[string]bool{"rx-checksum": true, "tx-tcp-segmentation": false}, features)
+
+	features, err = EthtoolFeatures(state, "lo")
+	assert.NoError(t, err, "must succeed on interface without ethtool data")
+	assert.Empty(t, features, "interface without ethtool data should have no features")
+
+	_, err = EthtoolFeatures(state, "eth2")
+	assert.Error(t, err, "must fail on missing interface")
+}
+
+func TestSplitByInterface(t *testing.T) {
+	state := `{
+"interfaces": [{
+  "name": "br0",
+  "type": "ovs-bridge",
+  "state": "up",
+  "bridge": {"port": [{"name": "br0"}]}
+}, {
+  "name": "br0",
+  "type": "ovs-interface",
+  "state": "up"
+}, {
+  "name": "dummy1",
+  "type": "dummy",
+  "state": "up",
+  "mtu": 9000
+}],
+"routes": {"config": [{"destination": "0.0.0.0/0", "next-hop-interface": "dummy1", "next-hop-address": "192.0.2.1"}]},
+"dns-resolver": {"config": {"server": ["192.0.2.53"]}}
+}
+`
+	split, err := SplitByInterface(state)
+	assert.NoError(t, err, "must succeed splitting the net state")
+	assert.Len(t, split, 3, "must have one document per interface name plus the global one")
+	assert.Contains(t, split, "br0")
+	assert.Contains(t, split, "dummy1")
+	assert.Contains(t, split, GlobalStateKey)
+
+	var interfaces []interface{}
+	recombined := map[string]interface{}{}
+	for _, name := range []string{"br0", "dummy1", GlobalStateKey} {
+		doc, err := decodeState(split[name])
+		assert.NoError(t, err, "split document must be valid json")
+		for key, value := range doc {
+			if key == "interfaces" {
+				interfaces = append(interfaces, value.([]interface{})...)
+			} else {
+				recombined[key] = value
+			}
+		}
+	}
+	recombined["interfaces"] = interfaces
+	encoded, err := json.Marshal(recombined)
+	assert.NoError(t, err)
+	assert.JSONEq(t, state, string(encoded), "split documents must recombine to the original state")
+}
+
+func TestSplitByInterfaceWithoutGlobal(t *testing.T) {
+	split, err := SplitByInterface(`{"interfaces": [{"name": "dummy1", "type": "dummy"}]}`)
+	assert.NoError(t, err, "must succeed splitting the net state")
+	assert.Equal(t, map[string]string{"dummy1": `{"interfaces":[{"name":"dummy1","type":"dummy"}]}`}, split)
+}
+
+func TestFilterInterfacesByType(t *testing.T) {
+	state := `{
+"interfaces": [
+  {"name": "bond0", "type": "bond", "state": "up"},
+  {"name": "eth1", "type": "ethernet", "state": "up"},
+  {"name": "bond1", "type": "bond", "state": "down"}
+],
+"routes": {"running": []}
+}
+`
+	filtered, err := filterInterfacesByType(state, "bond")
+	assert.NoError(t, err, "must succeed filtering interfaces")
+	assert.JSONEq(t, `{"interfaces": [
+  {"name": "bond0", "type": "bond", "state": "up"},
+  {"name": "bond1", "type": "bond", "state": "down"}
+]}`, filtered)
+
+	filtered, err = filterInterfacesByType(state, "vrf")
+	assert.NoError(t, err, "must succeed filtering absent interface type")
+	assert.JSONEq(t, `{"interfaces": []}`, filtered)
+}
+
+func TestStripReadOnly(t *testing.T) {
+	stripped, err := StripReadOnly(`{
+"interfaces": [{
+  "name": "eth1",
+  "type": "ethernet",
+  "state": "up",
+  "mtu": 1500,
+  "min-mtu": 68,
+  "max-mtu": 9702,
+  "lldp": {
+    "enabled": true,
+    "neighbors": [[{"type": 5, "system-name": "switch1"}]]
+  }
+}, {
+  "name": "dummy1",
+  "type": "dummy",
+  "state": "up"
+}]}
+`)
+	assert.NoError(t, err, "must succeed stripping read-only properties")
+	assert.JSONEq(t, `{
+"interfaces": [{
+  "name": "eth1",
+  "type": "ethernet",
+  "state": "up",
+  "mtu": 1500,
+  "lldp": {"enabled": true}
+}, {
+  "name": "dummy1",
+  "type": "dummy",
+  "state": "up"
+}]}
+`, stripped)
+}
+
+func TestInterfaceTypeHistogram(t *testing.T) {
+	histogram, err := InterfaceTypeHistogram(`{
+"interfaces": [
+  {"name": "veth0", "type": "veth"},
+  {"name": "veth1", "type": "veth"},
+  {"name": "bond0", "type": "bond"},
+  {"name": "eth1"}
+]}
+`)
+	assert.NoError(t, err, "must succeed counting interfaces")
+	assert.Equal(t, map[string]int{"veth": 2, "bond": 1, "unknown": 1}, histogram)
+
+	histogram, err = InterfaceTypeHistogram(`{}`)
+	assert.NoError(t, err, "must succeed counting interfaces of empty state")
+	assert.Empty(t, histogram, "empty state should have no interfaces")
+}
+
+func TestCompactState(t *testing.T) {
+	state := `{
+  "interfaces": [
+    {
+      "name": "dummy1",
+      "description": "a  spaced\tdescription",
+      "type": "dummy"
+    }
+  ]
+}
+`
+	compact, err := CompactState(state)
+	assert.NoError(t, err, "must succeed compacting the net state")
+	assert.Equal(t, `{"interfaces":[{"name":"dummy1","description":"a  spaced\tdescription","type":"dummy"}]}`, compact)
+	assert.JSONEq(t, state, compact, "compacting must preserve the net state")
+
+	_, err = CompactState("interfaces: []")
+	assert.Error(t, err, "must fail on non json state")
+}
+
+func TestDropMissingAbsent(t *testing.T) {
+	desired := `{
+"interfaces": [
+  {"name": "dummy1", "state": "absent"},
+  {"name": "nonexistent0", "state": "absent"},
+  {"name": "dummy2", "type": "dummy", "state": "up"}
+]}
+`
+	current := `{"interfaces": [{"name": "dummy1", "type": "dummy", "state": "up"}]}`
+	state, err := dropMissingAbsent(desired, current)
+	assert.NoError(t, err, "must succeed removing missing absent interfaces")
+	assert.JSONEq(t, `{
+"interfaces": [
+  {"name": "dummy1", "state": "absent"},
+  {"name": "dummy2", "type": "dummy", "state": "up"}
+]}
+`, state)
+
+	state, err = dropMissingAbsent(`{"routes": {"config": []}}`, current)
+	assert.NoError(t, err, "must succeed on state without interfaces")
+	assert.Equal(t, `{"routes": {"config": []}}`, state, "state without interfaces must be untouched")
+}
+
+func TestCheckManagedInterfaces(t *testing.T) {
+	nms := New(WithManagedInterfaces("dummy1", "dummy2"))
+	assert.NoError(t, nms.checkManagedInterfaces(`{
+"interfaces": [{"name": "dummy1", "type": "dummy", "state": "up"}],
+"routes": {"config": [{"destination": "198.51.100.0/24", "next-hop-interface": "dummy2"}]}
+}`), "state only referencing managed interfaces must be allowed")
+
+	err := nms.checkManagedInterfaces(`{
+"interfaces": [{"name": "eth1", "type": "ethernet", "state": "down"}],
+"routes": {"config": [{"destination": "198.51.100.0/24", "next-hop-interface": "eth0"}]}
+}`)
+	assert.EqualError(t, err, "net state references interfaces not managed by this client: eth0, eth1")
+
+	_, err = nms.ApplyNetState(`{"interfaces": [{"name": "eth1", "type": "ethernet", "state": "down"}]}`)
+	assert.EqualError(t, err, "net state references interfaces not managed by this client: eth1", "apply must be rejected before reaching libnmstate")
+
+	assert.NoError(t, New().checkManagedInterfaces(`{"interfaces": [{"name": "eth1"}]}`), "all interfaces must be allowed without the option")
+}
+
+func TestSortInterfaces(t *testing.T) {
+	shuffled := []string{`{
+"interfaces": [
+  {"name": "eth1", "type": "ethernet", "mtu": 1500},
+  {"name": "br0", "type": "ovs-interface"},
+  {"name": "br0", "type": "ovs-bridge"}
+],
+"routes": {"config": [
+  {"destination": "198.51.100.0/24", "next-hop-interface": "eth1", "table-id": 100},
+  {"destination": "0.0.0.0/0", "next-hop-interface": "eth1", "table-id": 254},
+  {"destination": "0.0.0.0/0", "next-hop-interface": "br0", "table-id": 254}
+]},
+"dns-resolver": {"config": {"server": ["192.0.2.53", "192.0.2.1"]}}
+}`, `{
+"dns-resolver": {"config": {"server": ["192.0.2.53", "192.0.2.1"]}},
+"routes": {"config": [
+  {"destination": "0.0.0.0/0", "next-hop-interface": "br0", "table-id": 254},
+  {"destination": "198.51.100.0/24", "next-hop-interface": "eth1", "table-id": 100},
+  {"destination": "0.0.0.0/0", "next-hop-interface": "eth1", "table-id": 254}
+]},
+"interfaces": [
+  {"name": "br0", "type": "ovs-bridge"},
+  {"name": "eth1", "type": "ethernet", "mtu": 1500},
+  {"name": "br0", "type": "ovs-interface"}
+]
+}`}
+	expected := `{"dns-resolver":{"config":{"server":["192.0.2.53","192.0.2.1"]}},` +
+		`"interfaces":[{"name":"br0","type":"ovs-bridge"},{"name":"br0","type":"ovs-interface"},{"mtu":1500,"name":"eth1","type":"ethernet"}],` +
+		`"routes":{"config":[{"destination":"198.51.100.0/24","next-hop-interface":"eth1","table-id":100},` +
+		`{"destination":"0.0.0.0/0","next-hop-interface":"br0","table-id":254},` +
+		`{"destination":"0.0.0.0/0","next-hop-interface":"eth1","table-id":254}]}}`
+	for _, state := range shuffled {
+		sorted, err := SortInterfaces(state)
+		assert.NoError(t, err, "must succeed sorting state")
+		assert.Equal(t, expected, sorted)
+
+		again, err := SortInterfaces(sorted)
+		assert.NoError(t, err, "must succeed sorting sorted state")
+		assert.Equal(t, sorted, again, "sorting must be idempotent")
+	}
+}
+
+func TestCheckManagedInterfacesReferences(t *testing.T) {
+	nms := New(WithManagedInterfaces("bond0", "eth1", "vlan10"))
+	err := nms.checkManagedInterfaces(`{"interfaces": [{
+"name": "bond0", "type": "bond", "state": "up",
+"link-aggregation": {"mode": "active-backup", "port": ["eth1", "eth2"]}
+}]}`)
+	assert.EqualError(t, err, "net state references interfaces not managed by this client: eth2", "bond port must be managed")
+
+	err = nms.checkManagedInterfaces(`{"interfaces": [{
+"name": "vlan10", "type": "vlan", "state": "up",
+"vlan": {"base-iface": "eth3", "id": 10}
+}]}`)
+	assert.EqualError(t, err, "net state references interfaces not managed by this client: eth3", "vlan base interface must be managed")
+
+	err = nms.checkManagedInterfaces(`{
+"interfaces": [
+  {"name": "eth1", "type": "ethernet", "controller": "br0"},
+  {"name": "br1", "type": "ovs-bridge", "bridge": {"port": [{"name": "ovs-bond0", "link-aggregation": {"port": [{"name": "eth4"}]}}]}}
+],
+"route-rules": {"config": [{"ip-from": "192.0.2.0/24", "iif": "eth5"}]},
+"dns-resolver": {"config": {"server": ["fe80::1%eth6", "192.0.2.53"]}}
+}`)
+	assert.EqualError(t, err, "net state references interfaces not managed by this client: br0, br1, eth4, eth5, eth6, ovs-bond0")
+
+	nms = New(WithManagedInterfaces("team0", "macsec0", "ipvlan0", "patch0"))
+	err = nms.checkManagedInterfaces(`{"interfaces": [
+  {"name": "team0", "type": "team", "team": {"ports": [{"name": "eth7"}]}},
+  {"name": "macsec0", "type": "macsec", "macsec": {"base-iface": "eth8"}},
+  {"name": "ipvlan0", "type": "ipvlan", "ipvlan": {"base-iface": "eth9"}},
+  {"name": "patch0", "type": "ovs-interface", "patch": {"peer": "patch1"}}
+]}`)
+	assert.EqualError(t, err, "net state references interfaces not managed by this client: eth7, eth8, eth9, patch1", "team ports, macsec and ipvlan base interfaces and patch peers must be managed")
+}
+
+func TestManagedInterfacesOnEveryApply(t *testing.T) {
+	nms := New(WithManagedInterfaces("dummy1"))
+	_, err := nms.ApplyNoVerifyThenCheck(`{"interfaces": [{"name": "eth1", "type": "ethernet", "state": "down"}]}`, func(string) error {
+		return nil
+	})
+	assert.EqualError(t, err, "net state references interfaces not managed by this client: eth1")
+}
@@ -0,0 +1,178 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// templateExcerptLength is the number of characters of the rendered state
+// reported on each side of a json syntax error.
+const templateExcerptLength = 20
+
+// ApplyNetStateTemplate renders tmpl, a text/template of a network state in
+// json format, with vars and applies the result. Referencing a variable
+// missing from vars is an error. Every action is inserted encoded as json, so
+// quotes or backslashes in a value cannot break the document: strings must
+// not be quoted in the template, like {"name": {{.iface}}}, and are built with
+// printf, like {"name": {{printf "%s.%d" .base .id}}}. The "json" template
+// function, which does the same encoding, is kept for templates using it
+// explicitly. A rendered
+// state which is not json is reported with a short excerpt around the syntax
+// error, the string values of vars hidden from it. This function returns the
+// applied network state or an error.
+func (n *Nmstate) ApplyNetStateTemplate(tmpl string, vars map[string]interface{}) (string, error) {
+	state, err := renderStateTemplate(tmpl, vars)
+	if err != nil {
+		return "", err
+	}
+	return n.ApplyNetState(state)
+}
+
+func renderStateTemplate(tmpl string, vars map[string]interface{}) (string, error) {
+	parsed, err := template.New("state").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"json": templateJSON}).
+		Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("failed parsing state template: %v", err)
+	}
+	for _, t := range parsed.Templates() {
+		if t.Tree != nil {
+			escapeActions(t.Tree, t.Tree.Root)
+		}
+	}
+	var rendered strings.Builder
+	if err := parsed.Execute(&rendered, vars); err != nil {
+		return "", fmt.Errorf("failed rendering state template: %v", err)
+	}
+	state := rendered.String()
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(state), &decoded); err != nil {
+		var syntaxErr *json.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			return "", fmt.Errorf("rendered state template is not valid json: %v", err)
+		}
+		return "", fmt.Errorf("rendered state template is not valid json: %v at offset %d near %q",
+			err, syntaxErr.Offset, templateExcerpt(state, int(syntaxErr.Offset), templateStrings(vars)))
+	}
+	return state, nil
+}
+
+// templateExcerpt returns the text of state around offset with the secrets
+// provided hidden. The excerpt is widened to whole secrets so no part of one
+// is left visible.
+func templateExcerpt(state string, offset int, secrets []string) string {
+	start, end := offset-templateExcerptLength, offset+templateExcerptLength
+	if start < 0 {
+		start = 0
+	}
+	if end > len(state) {
+		end = len(state)
+	}
+	for widened := true; widened; {
+		widened = false
+		for _, secret := range secrets {
+			for i := strings.Index(state, secret); i >= 0 && secret != ""; {
+				if i < end && i+len(secret) > start && (i < start || i+len(secret) > end) {
+					if i < start {
+						start = i
+					}
+					if i+len(secret) > end {
+						end = i + len(secret)
+					}
+					widened = true
+				}
+				next := strings.Index(state[i+1:], secret)
+				if next < 0 {
+					break
+				}
+				i += 1 + next
+			}
+		}
+	}
+	return hideSecrets(state[start:end], secrets)
+}
+
+// templateStrings returns the string values of the template vars, as given
+// and as rendered in json, longest first, as any of them may be a secret.
+func templateStrings(vars map[string]interface{}) []string {
+	values := []string{}
+	var collect func(value interface{})
+	collect = func(value interface{}) {
+		switch value := value.(type) {
+		case string:
+			values = append(values, value)
+			if encoded, err := templateJSON(value); err == nil && encoded[1:len(encoded)-1] != value {
+				values = append(values, encoded[1:len(encoded)-1])
+			}
+		case map[string]interface{}:
+			for _, field := range value {
+				collect(field)
+			}
+		case []interface{}:
+			for _, entry := range value {
+				collect(entry)
+			}
+		}
+	}
+	for _, value := range vars {
+		collect(value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	return values
+}
+
+// escapeActions ends the pipeline of every action printing a value under
+// node with the json function, unless it already ends with it.
+func escapeActions(tree *parse.Tree, node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			escapeActions(tree, child)
+		}
+	case *parse.ActionNode:
+		if len(node.Pipe.Decl) > 0 {
+			return
+		}
+		last := node.Pipe.Cmds[len(node.Pipe.Cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "json" {
+			return
+		}
+		node.Pipe.Cmds = append(node.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      node.Pos,
+			Args:     []parse.Node{parse.NewIdentifier("json").SetTree(tree).SetPos(node.Pos)},
+		})
+	case *parse.IfNode:
+		escapeActions(tree, node.List)
+		escapeActions(tree, node.ElseList)
+	case *parse.RangeNode:
+		escapeActions(tree, node.List)
+		escapeActions(tree, node.ElseList)
+	case *parse.WithNode:
+		escapeActions(tree, node.List)
+		escapeActions(tree, node.ElseList)
+	}
+}
+
+// templateJSON encodes value as json without escaping HTML characters, so a
+// string is rendered as json usually writes it and hidden by templateExcerpt.
+func templateJSON(value interface{}) (string, error) {
+	var encoded strings.Builder
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(encoded.String(), "\n"), nil
+}
@@ -0,0 +1,62 @@
+package nmstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const dummyTemplate = `{
+"interfaces": [{
+  "name": {{json .iface}},
+  "state": "up",
+  "type": "dummy",
+  "mtu": {{.mtu}}
+}]}
+`
+
+func TestRenderStateTemplate(t *testing.T) {
+	state, err := renderStateTemplate(dummyTemplate, map[string]interface{}{"iface": "dummy1", "mtu": 1500})
+	assert.NoError(t, err, "must succeed rendering the template")
+	assert.JSONEq(t, `{"interfaces": [{"name": "dummy1", "state": "up", "type": "dummy", "mtu": 1500}]}`, state)
+
+	state, err = renderStateTemplate(dummyTemplate, map[string]interface{}{"iface": `dummy"1`, "mtu": 1500})
+	assert.NoError(t, err, "must succeed rendering a name with quotes")
+	assert.Contains(t, state, `"dummy\"1"`, "name must be escaped")
+}
+
+func TestRenderStateTemplateEscapesByDefault(t *testing.T) {
+	state, err := renderStateTemplate(`{"interfaces": [{"name": {{.iface}}, "type": "dummy"{{if .mtu}}, "mtu": {{.mtu}}{{end}}}]}`,
+		map[string]interface{}{"iface": `dummy1", "type": "bond`, "mtu": 1500})
+	assert.NoError(t, err, "must succeed rendering a value with quotes")
+	assert.JSONEq(t, `{"interfaces": [{"name": "dummy1\", \"type\": \"bond", "type": "dummy", "mtu": 1500}]}`, state,
+		"a value must not inject json structure")
+
+	state, err = renderStateTemplate(`{"name": {{printf "%s.%d" .base .id}}, "note": {{.note | json}}}`,
+		map[string]interface{}{"base": "eth1", "id": 10, "note": "<a & b>"})
+	assert.NoError(t, err, "must succeed rendering printf and explicit json")
+	assert.Equal(t, `{"name": "eth1.10", "note": "<a & b>"}`, state, "strings must be encoded once, without HTML escaping")
+}
+
+func TestRenderStateTemplateErrors(t *testing.T) {
+	_, err := renderStateTemplate(dummyTemplate, map[string]interface{}{"iface": "dummy1"})
+	assert.Error(t, err, "must fail on missing variable")
+
+	_, err = renderStateTemplate(`{"interfaces": [{"name": "{{.iface}}"}]}`, map[string]interface{}{"iface": "dummy1"})
+	assert.Error(t, err, "must fail when the rendered state is not json")
+}
+
+func TestRenderStateTemplateInvalidJSONHidesVars(t *testing.T) {
+	psk := `correct<horse>&"battery"-staple`
+	_, err := renderStateTemplate(`{"psk": {{.psk}} "name": "wlan0"}`, map[string]interface{}{"psk": psk})
+	assert.EqualError(t, err, `rendered state template is not valid json: invalid character '"' after object key:value pair at offset 45 near "<_password_hid_by_nmstate>\" \"name\": \"wlan0\"}"`)
+	assert.NotContains(t, err.Error(), "staple", "no part of a template var must be left in the error")
+	assert.NotContains(t, err.Error(), "horse", "no part of a template var must be left in the error")
+}
+
+func TestApplyNetStateTemplate(t *testing.T) {
+	nms := New()
+	netState, err := nms.ApplyNetStateTemplate(dummyTemplate, map[string]interface{}{"iface": "dummy1", "mtu": 1500})
+	assert.NoError(t, err, "must succeed calling nmstate_net_state_apply c binding")
+	assert.Contains(t, netState, `"dummy1"`, "applied state should contain the rendered interface")
+}
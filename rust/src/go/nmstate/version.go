@@ -0,0 +1,109 @@
+package nmstate
+
+// #cgo LDFLAGS: -ldl
+// #define _GNU_SOURCE
+// #include <dlfcn.h>
+// #include <nmstate.h>
+//
+// static const char *nmstate_library_path(void) {
+//     Dl_info info;
+//     if (dladdr((void *)nmstate_net_state_retrieve, &info) == 0) {
+//         return NULL;
+//     }
+//     return info.dli_fname;
+// }
+import "C"
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MinimumNmstateVersion is the oldest libnmstate release this binding
+// supports.
+const MinimumNmstateVersion = "2.2.0"
+
+// Version returns the version of the libnmstate headers the binding was
+// compiled with, in the "major.minor.micro" form. It is fixed at build time,
+// see LibraryVersion for the library loaded at runtime, which may differ if
+// it was replaced after the build.
+func Version() string {
+	return fmt.Sprintf("%d.%d.%d", C.NMSTATE_VERSION_MAJOR, C.NMSTATE_VERSION_MINOR, C.NMSTATE_VERSION_MICRO)
+}
+
+// LibraryVersion returns the version of the libnmstate library loaded at
+// runtime, in the "major.minor.micro" form. The C API has no call reporting
+// it, so it is taken from the file name the library was loaded from, like
+// libnmstate.so.2.2.16, following symbolic links. It fails for a library
+// file name without version.
+func LibraryVersion() (string, error) {
+	path := C.GoString(C.nmstate_library_path())
+	if path == "" {
+		return "", fmt.Errorf("failed finding the loaded libnmstate library")
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return libraryVersion(filepath.Base(path))
+}
+
+// CheckABICompatibility returns an error when the libnmstate library loaded
+// at runtime, as reported by LibraryVersion(), is older than
+// MinimumNmstateVersion or its version cannot be found.
+func CheckABICompatibility() error {
+	version, err := LibraryVersion()
+	if err != nil {
+		return fmt.Errorf("failed checking libnmstate compatibility: %v", err)
+	}
+	return checkVersion(version)
+}
+
+// libraryVersion returns the version suffix of a libnmstate library file
+// name.
+func libraryVersion(name string) (string, error) {
+	_, version, found := cutString(name, ".so.")
+	if !found {
+		return "", fmt.Errorf("no version in libnmstate library name %q", name)
+	}
+	if _, err := parseVersion(version); err != nil {
+		return "", fmt.Errorf("no version in libnmstate library name %q", name)
+	}
+	return version, nil
+}
+
+func checkVersion(version string) error {
+	current, err := parseVersion(version)
+	if err != nil {
+		return fmt.Errorf("failed checking libnmstate compatibility: %v", err)
+	}
+	minimum, err := parseVersion(MinimumNmstateVersion)
+	if err != nil {
+		return fmt.Errorf("failed checking libnmstate compatibility: %v", err)
+	}
+	for i := range minimum {
+		if current[i] > minimum[i] {
+			return nil
+		}
+		if current[i] < minimum[i] {
+			return fmt.Errorf("libnmstate version %s is too old, at least %s is required", version, MinimumNmstateVersion)
+		}
+	}
+	return nil
+}
+
+func parseVersion(version string) ([3]int, error) {
+	var parsed [3]int
+	fields := strings.Split(version, ".")
+	if len(fields) != len(parsed) {
+		return parsed, fmt.Errorf("invalid version %q", version)
+	}
+	for i, field := range fields {
+		number, err := strconv.Atoi(field)
+		if err != nil || number < 0 {
+			return parsed, fmt.Errorf("invalid version %q", version)
+		}
+		parsed[i] = number
+	}
+	return parsed, nil
+}
@@ -0,0 +1,30 @@
+package nmstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckABICompatibility(t *testing.T) {
+	assert.NoError(t, CheckABICompatibility(), "must be loaded with a compatible libnmstate")
+}
+
+func TestLibraryVersion(t *testing.T) {
+	version, err := libraryVersion("libnmstate.so.2.2.16")
+	assert.NoError(t, err, "must succeed finding the version")
+	assert.Equal(t, "2.2.16", version)
+
+	_, err = libraryVersion("libnmstate.so.2")
+	assert.EqualError(t, err, `no version in libnmstate library name "libnmstate.so.2"`)
+	_, err = libraryVersion("libnmstate.so")
+	assert.EqualError(t, err, `no version in libnmstate library name "libnmstate.so"`)
+}
+
+func TestCheckVersion(t *testing.T) {
+	assert.NoError(t, checkVersion(MinimumNmstateVersion), "minimum version must be accepted")
+	assert.NoError(t, checkVersion("2.10.0"), "newer minor version must be accepted")
+	assert.Error(t, checkVersion("1.4.4"), "older major version must be rejected")
+	assert.Error(t, checkVersion("2.1.9"), "older minor version must be rejected")
+	assert.Error(t, checkVersion("2.2"), "malformed version must be rejected")
+}
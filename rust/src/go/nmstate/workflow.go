@@ -0,0 +1,200 @@
+package nmstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrTargetUnreachable is returned by ApplyNetState when the target set with
+// WithRollbackIfUnreachable could not be reached after applying, in which
+// case the change was rolled back.
+var ErrTargetUnreachable = errors.New("target unreachable after apply")
+
+const reachableRetryInterval = 500 * time.Millisecond
+
+// ApplyNoVerifyThenCheck applies the network state in json format without
+// nmstate verification and then calls check with the current network state
+// in json format instead. When retrieving the current state or check fails
+// the change is rolled back, otherwise it is committed unless WithNoCommit()
+// is set. This function returns the applied network state or an error.
+func (n *Nmstate) ApplyNoVerifyThenCheck(state string, check func(current string) error) (string, error) {
+	if err := n.checkCommitDelay(0); err != nil {
+		return "", err
+	}
+	applied, err := n.applyNetState(state, n.flags|noVerify|noCommit)
+	if err != nil {
+		return "", err
+	}
+	current, err := n.RetrieveNetState()
+	if err == nil {
+		err = check(current)
+		if err != nil {
+			err = fmt.Errorf("failed checking applied state: %v", err)
+		}
+	}
+	if err != nil {
+		if _, rollbackErr := n.RollbackCheckpoint(""); rollbackErr != nil {
+			return "", fmt.Errorf("%v, rollback also failed: %v", err, rollbackErr)
+		}
+		return "", err
+	}
+	if err := n.autoCommit(); err != nil {
+		return "", err
+	}
+	return applied, nil
+}
+
+func (n *Nmstate) applyIfReachable(state string) (string, error) {
+	if err := n.checkCommitDelay(n.rollbackTimeout); err != nil {
+		return "", err
+	}
+	applied, err := n.applyNetState(state, n.flags|noCommit)
+	if err != nil {
+		return "", err
+	}
+	if !waitReachable(n.rollbackTarget, n.rollbackTimeout) {
+		err := fmt.Errorf("%w: %s did not answer within %v", ErrTargetUnreachable, n.rollbackTarget, n.rollbackTimeout)
+		if _, rollbackErr := n.RollbackCheckpoint(""); rollbackErr != nil {
+			return "", fmt.Errorf("%v, rollback also failed: %v", err, rollbackErr)
+		}
+		return "", err
+	}
+	if err := n.autoCommit(); err != nil {
+		return "", err
+	}
+	return applied, nil
+}
+
+// waitReachable tries to open a TCP connection to target until it succeeds
+// or timeout expires.
+func waitReachable(target string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false
+		}
+		conn, err := net.DialTimeout("tcp", target, remaining)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		if time.Until(deadline) < reachableRetryInterval {
+			return false
+		}
+		time.Sleep(reachableRetryInterval)
+	}
+}
+
+// ApplyIf retrieves the current network state in json format and applies the
+// network state provided only if predicate returns true for it. This function
+// returns the applied network state, whether the apply was skipped, or an
+// error from retrieving, the predicate or applying.
+func (n *Nmstate) ApplyIf(state string, predicate func(current string) (bool, error)) (applied string, skipped bool, err error) {
+	current, err := n.RetrieveNetState()
+	if err != nil {
+		return "", false, err
+	}
+	ok, err := predicate(current)
+	if err != nil {
+		return "", false, fmt.Errorf("failed evaluating apply predicate: %v", err)
+	}
+	if !ok {
+		return "", true, nil
+	}
+	applied, err = n.ApplyNetState(state)
+	return applied, false, err
+}
+
+// checkCommitDelay fails when waiting elapsed plus the commit delay would
+// reach the checkpoint timeout, as the change would be rolled back before the
+// commit. This holds with no commit delay too, for instance when elapsed is
+// the rollback timeout of WithRollbackIfUnreachable.
+func (n *Nmstate) checkCommitDelay(elapsed time.Duration) error {
+	timeout := time.Duration(n.timeout) * time.Second
+	if timeout == 0 || elapsed+n.commitDelay == 0 || elapsed+n.commitDelay < timeout {
+		return nil
+	}
+	if n.commitDelay == 0 {
+		return fmt.Errorf("rollback timeout %v is not shorter than the checkpoint timeout %v", elapsed, timeout)
+	}
+	return fmt.Errorf("commit delay %v is not shorter than the checkpoint timeout %v", elapsed+n.commitDelay, timeout)
+}
+
+// autoCommit commits the last active checkpoint after the commit delay,
+// unless WithNoCommit() leaves it to the caller.
+func (n *Nmstate) autoCommit() error {
+	if n.flags&noCommit != 0 {
+		return nil
+	}
+	if n.commitDelay > 0 {
+		sleep := n.sleep
+		if sleep == nil {
+			sleep = time.Sleep
+		}
+		sleep(n.commitDelay)
+	}
+	_, err := n.CommitCheckpoint("")
+	return err
+}
+
+// ApplyPerInterface splits the network state in json format like
+// SplitByInterface and applies each interface document sequentially in the
+// order the interfaces appear, followed by the document holding the
+// remaining sections like routes and DNS. onProgress, when not nil, is
+// called after each apply with the interface name, GlobalStateKey for the
+// remaining sections, and the apply error. Applying stops at the first
+// failure and that error is returned.
+//
+// Each document is applied in its own checkpoint, so unlike a single
+// ApplyNetState a failure only rolls back the failing document: interfaces
+// applied before it stay applied. Interfaces depending on each other, like a
+// bond and its ports, may also fail verification when applied separately.
+// With WithIdempotencyKey each document is remembered under the key followed
+// by "/" and the interface name, or nothing for the remaining sections, so
+// retrying a partially failed apply skips the documents already applied.
+// WithNoCommit() is not supported, as the checkpoint of the first document
+// would make applying the next one fail. This function returns the network
+// state provided or an error.
+func (n *Nmstate) ApplyPerInterface(state string, onProgress func(iface string, err error)) (string, error) {
+	if n.flags&noCommit != 0 {
+		return "", fmt.Errorf("applying per interface is not supported with no commit, each document needs its checkpoint committed before the next one")
+	}
+	docs, err := splitByInterface(state)
+	if err != nil {
+		return "", err
+	}
+	apply := func(name, state string) (string, error) {
+		if n.idempotencyKey == "" {
+			return n.applyWithKey("", state)
+		}
+		return n.applyWithKey(n.idempotencyKey+"/"+name, state)
+	}
+	if err := applyDocuments(docs, apply, onProgress); err != nil {
+		return "", err
+	}
+	return n.indentJSON(state), nil
+}
+
+func applyDocuments(docs []splitDocument, apply func(name, state string) (string, error), onProgress func(iface string, err error)) error {
+	for _, doc := range docs {
+		encoded, err := json.Marshal(doc.state)
+		if err != nil {
+			return fmt.Errorf("failed encoding state of %q: %v", doc.name, err)
+		}
+		_, err = apply(doc.name, string(encoded))
+		if onProgress != nil {
+			onProgress(doc.name, err)
+		}
+		if err != nil {
+			if doc.name == GlobalStateKey {
+				return fmt.Errorf("failed applying global state: %v", err)
+			}
+			return fmt.Errorf("failed applying interface %s: %v", doc.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package nmstate
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyNoVerifyThenCheck(t *testing.T) {
+	nms := New()
+	_, err := nms.ApplyNoVerifyThenCheck(`{
+"interfaces": [{
+  "name": "dummy2",
+  "state": "up",
+  "type": "dummy"
+}]}
+`, func(current string) error {
+		if !strings.Contains(current, `"dummy2"`) {
+			return fmt.Errorf("dummy2 not found")
+		}
+		return nil
+	})
+	assert.NoError(t, err, "must succeed when the check passes")
+
+	_, err = nms.ApplyNoVerifyThenCheck(`{
+"interfaces": [{
+  "name": "dummy3",
+  "state": "up",
+  "type": "dummy"
+}]}
+`, func(current string) error {
+		return fmt.Errorf("rejected by test")
+	})
+	assert.Error(t, err, "must fail when the check fails")
+
+	dummies, err := nms.RetrieveByType("dummy")
+	assert.NoError(t, err, "must succeed retrieving dummy interfaces")
+	assert.Contains(t, dummies, `"dummy2"`, "checked change must be committed")
+	assert.NotContains(t, dummies, `"dummy3"`, "rejected change must be rolled back")
+}
+
+func TestApplyNetStateRollbackIfUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	unreachable := listener.Addr().String()
+	listener.Close()
+
+	nms := New(WithRollbackIfUnreachable(unreachable, time.Second))
+	_, err = nms.ApplyNetState(`{
+"interfaces": [{
+  "name": "dummy4",
+  "state": "up",
+  "type": "dummy"
+}]}
+`)
+	assert.True(t, errors.Is(err, ErrTargetUnreachable), "must fail when the target is unreachable")
+
+	dummies, err := nms.RetrieveByType("dummy")
+	assert.NoError(t, err, "must succeed retrieving dummy interfaces")
+	assert.NotContains(t, dummies, `"dummy4"`, "change must be rolled back")
+}
+
+func TestWaitReachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	target := listener.Addr().String()
+	assert.True(t, waitReachable(target, time.Second), "listening target must be reachable")
+
+	listener.Close()
+	assert.False(t, waitReachable(target, 100*time.Millisecond), "closed target must be unreachable")
+}
+
+func TestApplyIf(t *testing.T) {
+	nms := New()
+	hasLoopback := func(current string) (bool, error) {
+		return strings.Contains(current, `"lo"`), nil
+	}
+	hasNoLoopback := func(current string) (bool, error) {
+		return !strings.Contains(current, `"lo"`), nil
+	}
+
+	applied, skipped, err := nms.ApplyIf(`{"interfaces": [{"name": "dummy6", "state": "up", "type": "dummy"}]}`, hasLoopback)
+	assert.NoError(t, err, "must succeed applying when the predicate holds")
+	assert.False(t, skipped, "apply must not be skipped")
+	assert.Contains(t, applied, `"dummy6"`)
+
+	applied, skipped, err = nms.ApplyIf(`{"interfaces": [{"name": "dummy6", "state": "absent"}]}`, hasNoLoopback)
+	assert.NoError(t, err, "must succeed skipping when the predicate does not hold")
+	assert.True(t, skipped, "apply must be skipped")
+	assert.Empty(t, applied)
+
+	dummies, err := nms.RetrieveByType("dummy")
+	assert.NoError(t, err, "must succeed retrieving dummy interfaces")
+	assert.Contains(t, dummies, `"dummy6"`, "skipped change must not be applied")
+}
+
+func TestApplyWithCommitDelay(t *testing.T) {
+	events := []string{}
+	nms := New(WithCommitDelay(3 * time.Second))
+	nms.sleep = func(d time.Duration) {
+		events = append(events, fmt.Sprintf("sleep %v", d))
+	}
+	_, err := nms.ApplyNoVerifyThenCheck(`{"interfaces": [{"name": "dummy7", "state": "up", "type": "dummy"}]}`, func(current string) error {
+		events = append(events, "check")
+		return nil
+	})
+	assert.NoError(t, err, "must succeed applying with a commit delay")
+	assert.Equal(t, []string{"check", "sleep 3s"}, events, "commit must wait for the delay once the check passed")
+	assert.Zero(t, nms.DiagnoseLeaks().OutstandingCheckpoints, "checkpoint must be committed after the delay")
+}
+
+func TestCheckCommitDelay(t *testing.T) {
+	assert.NoError(t, New(WithCommitDelay(time.Second), WithTimeout(5*time.Second)).checkCommitDelay(time.Second))
+	assert.NoError(t, New(WithCommitDelay(time.Minute)).checkCommitDelay(0), "delay must not be limited without timeout")
+	assert.Error(t, New(WithCommitDelay(5*time.Second), WithTimeout(5*time.Second)).checkCommitDelay(0), "delay must be shorter than the checkpoint timeout")
+	assert.Error(t, New(WithCommitDelay(time.Second), WithTimeout(5*time.Second)).checkCommitDelay(4*time.Second), "delay and checks must be shorter than the checkpoint timeout")
+	assert.NoError(t, New(WithTimeout(5*time.Second)).checkCommitDelay(4*time.Second))
+	assert.EqualError(t, New(WithTimeout(5*time.Second)).checkCommitDelay(5*time.Second),
+		"rollback timeout 5s is not shorter than the checkpoint timeout 5s", "checks must be shorter than the checkpoint timeout without delay")
+}
+
+func TestApplyRollbackTimeoutNotShorterThanTimeout(t *testing.T) {
+	calls := 0
+	nms := New(WithTimeout(10*time.Second), WithRollbackIfUnreachable("127.0.0.1:22", 10*time.Second))
+	nms.onCall = func(string, uint32) {
+		calls++
+	}
+	_, err := nms.ApplyNetState(`{"interfaces": [{"name": "dummy5", "state": "up", "type": "dummy"}]}`)
+	assert.EqualError(t, err, "rollback timeout 10s is not shorter than the checkpoint timeout 10s")
+	assert.Zero(t, calls, "must fail before calling libnmstate")
+}
+
+func TestApplyDocumentsProgress(t *testing.T) {
+	docs, err := splitByInterface(`{
+"interfaces": [
+  {"name": "dummy2", "type": "dummy"},
+  {"name": "dummy1", "type": "dummy"},
+  {"name": "dummy3", "type": "dummy"}
+],
+"routes": {"config": []}
+}`)
+	assert.NoError(t, err, "must succeed splitting state")
+
+	progress := []string{}
+	onProgress := func(iface string, err error) {
+		assert.NoError(t, err)
+		progress = append(progress, iface)
+	}
+	err = applyDocuments(docs, func(name, state string) (string, error) { return state, nil }, onProgress)
+	assert.NoError(t, err, "must succeed applying documents")
+	assert.Equal(t, []string{"dummy2", "dummy1", "dummy3", GlobalStateKey}, progress)
+
+	progress = []string{}
+	failures := []string{}
+	err = applyDocuments(docs, func(name, state string) (string, error) {
+		if strings.Contains(state, "dummy1") {
+			return "", errors.New("apply failed")
+		}
+		return state, nil
+	}, func(iface string, err error) {
+		progress = append(progress, iface)
+		if err != nil {
+			failures = append(failures, iface)
+		}
+	})
+	assert.EqualError(t, err, "failed applying interface dummy1: apply failed")
+	assert.Equal(t, []string{"dummy2", "dummy1"}, progress, "must stop at the first failure")
+	assert.Equal(t, []string{"dummy1"}, failures)
+}
+
+func TestApplyPerInterfaceNoCommit(t *testing.T) {
+	calls := 0
+	nms := New(WithNoCommit())
+	nms.onCall = func(string, uint32) {
+		calls++
+	}
+	_, err := nms.ApplyPerInterface(`{"interfaces": [
+  {"name": "dummy1", "type": "dummy", "state": "up"},
+  {"name": "dummy2", "type": "dummy", "state": "up"}
+]}`, func(iface string, err error) {
+		t.Errorf("no document must be applied, got progress for %s", iface)
+	})
+	assert.EqualError(t, err, "applying per interface is not supported with no commit, each document needs its checkpoint committed before the next one")
+	assert.Zero(t, calls, "must fail before calling libnmstate")
+}